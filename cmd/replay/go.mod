@@ -0,0 +1,23 @@
+module github.com/makuc/a-novels-backend/cmd/replay
+
+go 1.12
+
+require (
+	cloud.google.com/go v0.49.0
+	cloud.google.com/go/firestore v1.1.0
+	github.com/makuc/a-novels-backend v0.0.0
+	github.com/makuc/a-novels-backend/functions/novels/update v0.0.0
+	github.com/makuc/a-novels-backend/functions/users/delete v0.0.0
+	github.com/makuc/a-novels-backend/functions/users/update v0.0.0
+	github.com/makuc/diploma/functions/files/deleted v0.0.0
+	github.com/makuc/diploma/functions/files/uploaded v0.0.0
+)
+
+replace (
+	github.com/makuc/a-novels-backend => ../..
+	github.com/makuc/a-novels-backend/functions/novels/update => ../../functions/novels/update
+	github.com/makuc/a-novels-backend/functions/users/delete => ../../functions/users/delete
+	github.com/makuc/a-novels-backend/functions/users/update => ../../functions/users/update
+	github.com/makuc/diploma/functions/files/deleted => ../../functions/files/deleted
+	github.com/makuc/diploma/functions/files/uploaded => ../../functions/files/uploaded
+)
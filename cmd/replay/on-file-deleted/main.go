@@ -0,0 +1,21 @@
+// Command on-file-deleted replays an event of OnFileDeleted, see package replay.
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/makuc/a-novels-backend/cmd/replay"
+	"github.com/makuc/a-novels-backend/pkg/gcp/gcse"
+	"github.com/makuc/diploma/functions/files/deleted"
+)
+
+func main() {
+	replay.Main("on-file-deleted", "file-deleted-events", func(ctx context.Context, payload []byte) error {
+		var e gcse.GCSEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return deleted.OnFileDeleted(ctx, e)
+	})
+}
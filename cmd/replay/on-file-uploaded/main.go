@@ -0,0 +1,21 @@
+// Command on-file-uploaded replays an event of OnFileUploaded, see package replay.
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/makuc/a-novels-backend/cmd/replay"
+	"github.com/makuc/a-novels-backend/pkg/gcp/gcse"
+	"github.com/makuc/diploma/functions/files/uploaded"
+)
+
+func main() {
+	replay.Main("on-file-uploaded", "file-uploaded-events", func(ctx context.Context, payload []byte) error {
+		var e gcse.GCSEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return uploaded.OnFileUploaded(ctx, e)
+	})
+}
@@ -0,0 +1,21 @@
+// Command on-novel-update replays an event of OnNovelUpdate, see package replay.
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/makuc/a-novels-backend/cmd/replay"
+	novelupdate "github.com/makuc/a-novels-backend/functions/novels/update"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+)
+
+func main() {
+	replay.Main("on-novel-update", "novel-events", func(ctx context.Context, payload []byte) error {
+		var e gcp.FirestoreEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return novelupdate.OnNovelUpdate(ctx, e)
+	})
+}
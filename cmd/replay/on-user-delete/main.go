@@ -0,0 +1,21 @@
+// Command on-user-delete replays an event of OnUserDelete, see package replay.
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/makuc/a-novels-backend/cmd/replay"
+	userdelete "github.com/makuc/a-novels-backend/functions/users/delete"
+	"github.com/makuc/a-novels-backend/pkg/gcp/auth"
+)
+
+func main() {
+	replay.Main("on-user-delete", "user-delete-events", func(ctx context.Context, payload []byte) error {
+		var e auth.AuthEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return userdelete.OnUserDelete(ctx, e)
+	})
+}
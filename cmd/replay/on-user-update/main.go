@@ -0,0 +1,21 @@
+// Command on-user-update replays an event of OnUserUpdate, see package replay.
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/makuc/a-novels-backend/cmd/replay"
+	"github.com/makuc/a-novels-backend/functions/users/update"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+)
+
+func main() {
+	replay.Main("on-user-update", "user-events", func(ctx context.Context, payload []byte) error {
+		var e gcp.FirestoreEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return err
+		}
+		return update.OnUserUpdate(ctx, e)
+	})
+}
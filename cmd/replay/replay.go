@@ -0,0 +1,79 @@
+// Package replay re-invokes a function locally with an event captured in its lease document
+// (with `capturePayload` enabled) or in its dead letters. Every function has its own command
+// (e.g. `on-user-update`), so only that function is initialized.
+package replay
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/functions/metadata"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
+)
+
+// Handler decodes the captured payload and invokes the function with it.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Main replays an execution of function (e.g. `on-user-update`) with handler, as configured by flags. Lease
+// documents are read from env variable `leaseCollection` of the function, or else from defaultCollection.
+func Main(function string, defaultCollection string, handler Handler) {
+	if collection, ok := os.LookupEnv("leaseCollection"); ok {
+		defaultCollection = collection
+	}
+
+	projectID := flag.String("project", "testing-192515", "Google Cloud project ID")
+	collection := flag.String("collection", defaultCollection, "collection with lease documents")
+	key := flag.String("key", "", "key (document ID) of the execution to replay, e.g. "+function+":123456")
+	dead := flag.Bool("dead", false, "replay from dead letters, instead of the lease document")
+	sameID := flag.Bool("same-id", false, "replay with the original EventID, instead of a new one")
+	flag.Parse()
+
+	if *key == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	client, err := firestore.NewClient(ctx, *projectID)
+	if err != nil {
+		log.Fatalf("firestore.NewClient: %v", err)
+	}
+	defer client.Close()
+
+	store := idempotent.NewFirestoreStore(client, *collection)
+	ref := store.Ref(*key)
+	if *dead {
+		ref = store.DeadLetters().Doc(*key)
+	}
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		log.Fatalf("fetching %v: %v", ref.Path, err)
+	}
+
+	eventCtx, payload, err := idempotent.DecodeEvent(ctx, doc.Data())
+	if err != nil {
+		log.Fatalf("decoding event: %v", err)
+	}
+	if !*sameID {
+		// Original EventID is already completed or dead-lettered, so the lease wouldn't be granted
+		meta, err := metadata.FromContext(eventCtx)
+		if err != nil {
+			log.Fatalf("metadata.FromContext: %v", err)
+		}
+		meta.EventID = fmt.Sprintf("%v-replay-%v", meta.EventID, time.Now().Unix())
+		eventCtx = metadata.NewContext(ctx, meta)
+	}
+
+	// Leases of the replayed execution are namespaced as the original function's
+	os.Setenv("FUNCTION_NAME", function)
+
+	if err := handler(eventCtx, payload); err != nil {
+		log.Fatalf("%v: %v", function, err)
+	}
+	log.Printf("%v: replayed %v", function, *key)
+}
@@ -0,0 +1,111 @@
+package cleanup
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	firebase "firebase.google.com/go"
+	"github.com/makuc/a-novels-backend/pkg/gcp/cloudevents"
+	"github.com/makuc/a-novels-backend/pkg/gcp/pubsub"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
+)
+
+var (
+	client *firestore.Client
+	stores []*idempotent.FirestoreStore
+)
+
+// CleanupRequest is the (optional) JSON body of messages published by Cloud Scheduler.
+type CleanupRequest struct {
+	// Collections limits cleanup to these collections, instead of all the configured ones.
+	Collections []string `json:"collections"`
+}
+
+func init() {
+	ctx := context.Background()
+
+	projectID, ok := os.LookupEnv("GPC_PROJECT")
+	if !ok {
+		projectID = "testing-192515"
+	}
+
+	conf := &firebase.Config{
+		ProjectID: projectID,
+	}
+	// Initialize default app
+	app, err := firebase.NewApp(ctx, conf)
+	if err != nil {
+		log.Fatalf("firebase.NewApp: %v\n", err)
+	}
+	// Access firestore service from the default app
+	client, err = app.Firestore(ctx)
+	if err != nil {
+		log.Fatalf("app.Firestore: %v", err)
+	}
+
+	// Collections with idempotency records of all the functions, separated by `;`
+	collections, ok := os.LookupEnv("leaseCollections")
+	if !ok {
+		collections = "user-events;user-delete-events;novel-events;file-uploaded-events;file-deleted-events"
+	}
+	for _, collection := range strings.Split(collections, ";") {
+		stores = append(stores, idempotent.NewFirestoreStore(client, strings.TrimSpace(collection)))
+	}
+}
+
+// OnCleanupEvents executes on schedule, removing idempotency records of completed executions
+// older than `retentionDays` and of failed or dead-lettered ones older than `failedRetentionDays`.
+func OnCleanupEvents(ctx context.Context, m pubsub.Message) error {
+	m.Complete(ctx)
+
+	var req CleanupRequest
+	if err := m.Decode(&req); err != nil {
+		log.Printf("decoding message %v: %v", m.MessageID, err.Error())
+		return nil // No use retrying, result won't change
+	}
+	only := map[string]bool{}
+	for _, collection := range req.Collections {
+		only[collection] = true
+	}
+
+	completedRetention, err := idempotent.CompletedRetention()
+	if err != nil {
+		log.Printf("CompletedRetention: %v", err.Error())
+		return nil // No use retrying, result won't change
+	}
+	failedRetention, err := idempotent.FailedRetention()
+	if err != nil {
+		log.Printf("FailedRetention: %v", err.Error())
+		return nil // No use retrying, result won't change
+	}
+
+	completedBefore := time.Now().Add(-completedRetention)
+	failedBefore := time.Now().Add(-failedRetention)
+
+	for _, store := range stores {
+		if len(only) > 0 && !only[store.Collection().ID] {
+			continue
+		}
+		deleted, err := store.Purge(ctx, completedBefore, failedBefore)
+		if err != nil {
+			log.Printf("Purge %v: %v", store.Collection().ID, err.Error())
+			return err // Next scheduled run continues where this one stopped
+		}
+		log.Printf("Purge %v: deleted %v records", store.Collection().ID, deleted)
+	}
+
+	return nil
+}
+
+// onCleanupEventsCloudEvent adapts OnCleanupEvents to CloudEvents
+var onCleanupEventsCloudEvent = cloudevents.MustHandler(OnCleanupEvents)
+
+// OnCleanupEventsCloudEvent is the entry point of OnCleanupEvents for runtimes delivering CloudEvents over HTTP.
+func OnCleanupEventsCloudEvent(w http.ResponseWriter, r *http.Request) {
+	onCleanupEventsCloudEvent.ServeHTTP(w, r)
+}
@@ -0,0 +1,64 @@
+param(
+    # Script to execute
+    [Parameter()]
+    [string]
+    $exeFunc
+)
+
+# BEGIN Config
+
+$functionName = "on-cleanup-events"
+$entryPoint = "OnCleanupEvents"
+$projectId = "testing-192515"
+$triggerTopic = "cleanup-events"
+$schedule = "0 3 * * *"
+$leaseCollections = "user-events;user-delete-events;novel-events;file-uploaded-events;file-deleted-events"
+$envVariables = "leaseCollections=$leaseCollections,retentionDays=7,failedRetentionDays=30"
+
+# END Config
+
+function clean {
+    Remove-Item -LiteralPath "bin" -Force -Recurse -ErrorAction SilentlyContinue
+}
+function build {
+    Write-Host "Building the function"
+    go build
+}
+function tidy {
+    go mod tidy
+}
+function test {
+    Write-Host "Executing the tests"
+    go test .
+}
+function deploy {
+    Write-Host "Deploying the function..."
+	gcloud functions deploy `
+           $functionName `
+           --set-env-vars $envVariables `
+           --trigger-topic $triggerTopic `
+           --entry-point $entryPoint `
+           --runtime=go111 `
+           --memory=128MB
+}
+function schedule {
+    Write-Host "Scheduling the function..."
+    gcloud scheduler jobs create pubsub `
+           $functionName `
+           --schedule $schedule `
+           --topic $triggerTopic `
+           --message-body "{}"
+}
+function ttl {
+    Write-Host "Enabling TTL policies on expireAt..."
+    foreach ($collection in $leaseCollections.Split(";")) {
+        gcloud firestore fields ttls update expireAt --collection-group=$collection --enable-ttl
+        gcloud firestore fields ttls update expireAt --collection-group="$collection-dead-letters" --enable-ttl
+    }
+}
+
+
+# RUNS the COMMAND
+Clear-Host
+$env:GONOPROXY="*github.com/makuc"
+&$exeFunc
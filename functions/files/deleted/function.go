@@ -4,30 +4,34 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"time"
 
 	"cloud.google.com/go/firestore"
-	"cloud.google.com/go/functions/metadata"
 	"cloud.google.com/go/storage"
 	firebase "firebase.google.com/go"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+	"github.com/makuc/a-novels-backend/pkg/gcp/cloudevents"
+	"github.com/makuc/a-novels-backend/pkg/gcp/gcse"
 	"github.com/makuc/a-novels-backend/pkg/idempotent"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var (
 	app             *firebase.App
 	firestoreClient *firestore.Client
 	bucket          *storage.BucketHandle
+	leases          *idempotent.FirestoreStore
+
+	// router dispatches deleted objects to their handlers
+	router = newRouter()
 )
 
-// GCSEvent is the payload of a GCS event.
-type GCSEvent struct {
-	Bucket         string    `json:"bucket"`
-	Name           string    `json:"name"`
-	Metageneration string    `json:"metageneration"`
-	ResourceState  string    `json:"resourceState"`
-	TimeCreated    time.Time `json:"timeCreated"`
-	Updated        time.Time `json:"updated"`
+func newRouter() *gcse.Router {
+	r := gcse.NewRouter()
+	r.Handle("novels/{novelId}/full.jpg", leased(onNovelCoverDeleted))
+	return r
 }
 
 func init() {
@@ -76,49 +80,68 @@ func init() {
 		log.Fatalf("storageClient.DefaultBucket: %v", err)
 	}
 
-	idempotent.Client = firestoreClient
+	collection, ok := os.LookupEnv("leaseCollection")
+	if !ok {
+		collection = "file-deleted-events"
+	}
+	leases = idempotent.NewFirestoreStore(firestoreClient, collection)
 }
 
 // OnFileDeleted executes when a file is deleted from the storage bucket.
 // Performs all the necessary corrections (in DB) if necessary.
-func OnFileDeleted(ctx context.Context, e GCSEvent) error {
+func OnFileDeleted(ctx context.Context, e gcse.GCSEvent) error {
 
 	log.Printf("Resource state: %v", e.ResourceState) // == not-found ?? Shorter for deleted objects...
 
-	proceed, err := idempotent.ExecuteWithLease(ctx)
-	if err != nil {
-		return err
-	}
-	if !proceed {
-		return nil // EventID was already processed
+	return router.Dispatch(ctx, e) // objects without handlers are ignored
+}
+
+// onFileDeletedCloudEvent adapts OnFileDeleted to CloudEvents
+var onFileDeletedCloudEvent = cloudevents.MustHandler(OnFileDeleted)
+
+// OnFileDeletedCloudEvent is the entry point of OnFileDeleted for runtimes delivering CloudEvents over HTTP.
+func OnFileDeletedCloudEvent(w http.ResponseWriter, r *http.Request) {
+	onFileDeletedCloudEvent.ServeHTTP(w, r)
+}
+
+// leased adapts h into a handler executing it indempotently.
+func leased(h func(ctx context.Context, e gcse.GCSEvent, params gcp.Params) error) gcse.HandlerFunc {
+	return func(ctx context.Context, e gcse.GCSEvent, params gcp.Params) error {
+		return idempotent.Wrap(ctx, leases, e, func(ctx context.Context, lease *idempotent.Lease) error {
+			return h(ctx, e, params)
+		})
 	}
+}
 
-	_, err = metadata.FromContext(ctx) // Change _ => meta
-	if err != nil {
-		log.Fatalf("metadata.FromContext: %v", err)
+// onNovelCoverDeleted removes `cover` from novel, unless `novels/{novelId}/full.jpg` was overwritten.
+func onNovelCoverDeleted(ctx context.Context, e gcse.GCSEvent, params gcp.Params) error {
+	if e.IsOverwrite() {
+		return nil // Replaced with a new version, novel still has a cover
 	}
 
-	obj := bucket.Object(fmt.Sprintf("novels/%s/cover-full.jpg", e.Name[7:27]))
-	_, err = obj.Attrs(ctx) // _ => objAttrs
+	// Not every event reports overwrites, so make sure the cover is really gone
+	_, err := bucket.Object(e.Name).Attrs(ctx) // _ => objAttrs
+	if err == storage.ErrObjectNotExist {
+		// This file is deleted, so we can properly remove `cover` from novel
+		return setNovelNoCover(ctx, params["novelId"])
+	}
 	if err != nil {
-		if err.Error() == "storage: object doesn't exist" {
-			// This file is deleted, so we can properly remove `cover` from novel
-			setNovelNoCover(ctx, e.Name[7:27])
-			return nil
-		}
-
-		log.Fatalf("obj.Attrs: %v", err)
+		log.Printf("obj.Attrs: %v", err)
+		return err
 	}
-
 	return nil
 }
 
-func setNovelNoCover(ctx context.Context, novelID string) {
-	_, err := firestoreClient.Collection("novels").Doc(novelID).Set(ctx, map[string]interface{}{
-		"cover": false,
-	}, firestore.MergeAll)
-
+// setNovelNoCover sets `cover` of novel to false. Deleted novels (e.g. by account deletion) are left alone.
+func setNovelNoCover(ctx context.Context, novelID string) error {
+	_, err := firestoreClient.Collection("novels").Doc(novelID).Update(ctx, []firestore.Update{
+		{Path: "cover", Value: false},
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil // Novel is gone, nothing to update
+	}
 	if err != nil {
-		log.Fatalf("setNovelNoCover error: %v\n", err.Error())
+		log.Printf("setNovelNoCover error: %v\n", err.Error())
 	}
+	return err
 }
@@ -7,5 +7,8 @@ require (
 	cloud.google.com/go/firestore v1.1.0
 	cloud.google.com/go/storage v1.0.0
 	firebase.google.com/go v3.10.0+incompatible
-	github.com/makuc/a-novels-backend v0.0.0-20191208235341-0975d636cbe6
+	github.com/makuc/a-novels-backend v0.0.0
+	google.golang.org/grpc v1.25.1
 )
+
+replace github.com/makuc/a-novels-backend => ../../..
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
 	firebase "firebase.google.com/go"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+	"github.com/makuc/a-novels-backend/pkg/gcp/cloudevents"
 	"github.com/makuc/a-novels-backend/pkg/gcp/gcse"
 	"github.com/makuc/a-novels-backend/pkg/idempotent"
 )
@@ -17,14 +20,22 @@ var (
 	app             *firebase.App
 	firestoreClient *firestore.Client
 	bucket          *storage.BucketHandle
+	leases          *idempotent.FirestoreStore
+
+	// router dispatches uploaded objects to their processors
+	router = newRouter()
 
 	// tmp variables
-	progress    map[string]interface{}
-	progressRef *firestore.DocumentRef
-	projectID   string
-	bucketName  string
+	projectID  string
+	bucketName string
 )
 
+func newRouter() *gcse.Router {
+	r := gcse.NewRouter()
+	r.Handle("novels/{novelId}/cover.orig", leased(processNovelsCovers))
+	return r
+}
+
 func init() {
 	ctx := context.Background()
 
@@ -67,7 +78,11 @@ func init() {
 		log.Fatalf("error preparing firebase client: %v", err.Error())
 	}
 
-	idempotent.Client = firestoreClient
+	collection, ok := os.LookupEnv("leaseCollection")
+	if !ok {
+		collection = "file-uploaded-events"
+	}
+	leases = idempotent.NewFirestoreStore(firestoreClient, collection)
 
 	// Access storage services from the default app
 	storageClient, err := app.Storage(ctx)
@@ -87,27 +102,26 @@ func init() {
 func OnFileUploaded(ctx context.Context, e gcse.GCSEvent) error {
 	//return testiranje(ctx, e)
 
-	if proceed, err := idempotent.ExecuteWithLease(ctx); err != nil || !proceed {
-		return err
-	}
+	return router.Dispatch(ctx, e) // objects without processors are ignored
+}
 
-	// Prepare OBJ with PROGRESS Data
-	progressRef, err := idempotent.GetExecuteProgressRef(ctx)
-	if err != nil {
-		return err
-	}
-	data, err := progressRef.Get(ctx)
-	if err != nil {
-		return err
-	}
-	progress = data.Data()
+// onFileUploadedCloudEvent adapts OnFileUploaded to CloudEvents
+var onFileUploadedCloudEvent = cloudevents.MustHandler(OnFileUploaded)
 
-	if err := processNovelsCovers(ctx, e); err != nil {
-		// something went wrong while processing novel's cover, retry
-		return err
-	}
+// OnFileUploadedCloudEvent is the entry point of OnFileUploaded for runtimes delivering CloudEvents over HTTP.
+func OnFileUploadedCloudEvent(w http.ResponseWriter, r *http.Request) {
+	onFileUploadedCloudEvent.ServeHTTP(w, r)
+}
 
-	idempotent.ExecuteMarkComplete(ctx)
-	return nil
+// processor processes an uploaded object under a granted lease, with parameters bound from its name.
+type processor func(ctx context.Context, lease *idempotent.Lease, e gcse.GCSEvent, params gcp.Params) error
 
+// leased adapts p into a handler executing it indempotently. Something going wrong while
+// processing is retried (unless given up on).
+func leased(p processor) gcse.HandlerFunc {
+	return func(ctx context.Context, e gcse.GCSEvent, params gcp.Params) error {
+		return idempotent.Wrap(ctx, leases, e, func(ctx context.Context, lease *idempotent.Lease) error {
+			return p(ctx, lease, e, params)
+		})
+	}
 }
@@ -10,7 +10,7 @@ require (
 	github.com/golang/groupcache v0.0.0-20191027212112-611e8accdfc9 // indirect
 	github.com/google/go-cmp v0.3.1 // indirect
 	github.com/jstemmer/go-junit-report v0.9.1 // indirect
-	github.com/makuc/a-novels-backend v0.0.0-20191208235341-0975d636cbe6
+	github.com/makuc/a-novels-backend v0.0.0
 	go.opencensus.io v0.22.2 // indirect
 	golang.org/x/exp v0.0.0-20191129062945-2f5052295587 // indirect
 	golang.org/x/image v0.0.0-20190802002840-cff245a6509b
@@ -23,3 +23,5 @@ require (
 	google.golang.org/appengine v1.6.5 // indirect
 	google.golang.org/genproto v0.0.0-20191206224255-0243a4be9c8f // indirect
 )
+
+replace github.com/makuc/a-novels-backend => ../../..
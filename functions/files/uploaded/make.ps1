@@ -12,7 +12,7 @@ $entryPoint = "OnFileUploaded"
 $projectId = "testing-192515"
 $triggerEvent = "google.storage.object.finalize"
 $triggerResource = "$projectId.appspot.com"
-$envVars = "WorkerID=full-admin-rights,leaseSeconds=60"
+$envVars = "WorkerID=full-admin-rights,leaseSeconds=60,leaseCollection=file-uploaded-events,maxAttempts=5"
 
 # END Config
 
@@ -42,6 +42,7 @@ function deploy {
         --trigger-event $triggerEvent `
         --trigger-resource $triggerResource `
         --entry-point $entryPoint `
+        --retry `
         --set-env-vars $envVars `
         --runtime=go111 `
         --memory=128MB
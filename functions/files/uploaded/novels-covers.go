@@ -7,27 +7,27 @@ import (
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
 	"github.com/makuc/a-novels-backend/pkg/gcp/gcse"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
 	"golang.org/x/image/draw"
 )
 
-func processNovelsCovers(ctx context.Context, e gcse.GCSEvent) error {
-	nameLen := len(e.Name)
-	if nameLen < 32 || e.Name[:6] != "novels" || e.Name[nameLen-4:nameLen] != "orig" {
-		return nil // Execution not target at Covers
+// processNovelsCovers transforms uploaded `novels/{novelId}/cover.orig` into thumbnail and full-size cover.
+func processNovelsCovers(ctx context.Context, lease *idempotent.Lease, e gcse.GCSEvent, params gcp.Params) error {
+	cp, err := idempotent.GetCheckpoint(ctx, leases, "cover")
+	if err != nil {
+		return err
 	}
-
-	if coverProcessedRaw, ok := progress["cover"]; ok {
-		if coverProcessed, ok := coverProcessedRaw.(bool); ok && coverProcessed {
-			return nil
-		}
+	if cp.Done {
+		return nil // Cover was already processed
 	}
 
-	novelID := e.Name[7:27]
+	novelID := params["novelId"]
 	objSrc := bucket.Object(e.Name)
 	var src image.Image
 
-	err := func() error {
+	err = func() error {
 		// Prepare reader for Original Picture
 		rc, err := objSrc.NewReader(ctx)
 		defer rc.Close()
@@ -108,11 +108,8 @@ func processNovelsCovers(ctx context.Context, e gcse.GCSEvent) error {
 	}
 
 	// Succeeded, now mark as such
-	progressRef.Set(ctx, map[string]interface{}{
-		"cover": true,
-	}, firestore.MergeAll)
-
-	return nil
+	cp.Done = true
+	return idempotent.SaveCheckpoint(ctx, leases, lease, cp)
 }
 
 func setNovelHasCover(ctx context.Context, novelID string) error {
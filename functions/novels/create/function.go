@@ -2,54 +2,33 @@ package create
 
 import (
 	"cloud.google.com/go/firestore"
-	"cloud.google.com/go/functions/metadata"
 	"context"
 	firebase "firebase.google.com/go"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+	"github.com/makuc/a-novels-backend/pkg/gcp/cloudevents"
 	"log"
+	"net/http"
 	"os"
 	"time"
 )
 
 var client *firestore.Client
 
-// FirestoreEvent is the payload of a Firestore event.
-type FirestoreEvent struct {
-	OldValue   FirestoreValue `firestore:"oldValue"`
-	Value      FirestoreValue `firestore:"value"`
-	UpdateMask struct {
-		FieldPaths []string `firestore:"fieldPaths"`
-	} `firestore:"updateMask"`
-}
+// novelPattern matches documents this function is triggered by
+var novelPattern = gcp.MustParsePattern("novels/{novelId}")
 
-// FirestoreValue holds Firestore fields.
-type FirestoreValue struct {
-	CreateTime time.Time `firestore:"createTime"`
-	// Fields is the data for this value. The type depends on the format of your
-	// database. Log the interface{} value and inspect the result to see a JSON
-	// representation of your database fields.
-	Fields     NovelPart `firestore:"fields"`
-	Name       string    `firestore:"name"`
-	UpdateTime time.Time `firestore:"updateTime"`
-}
-type NovelPart struct {
-	ID struct {
-		StringValue string `firestore:"stringValue"`
-	} `firestore:"id"`
-	Title struct {
-		StringValue string `firestore:"stringValue"`
-	} `firestore:"title.stringValue"`
-}
+// Novel is a document in `novels` collection
 type Novel struct {
-	Id     string `firestore:"id"`
+	ID     string `firestore:"id"`
 	Title  string `firestore:"title"`
 	Author Author `firestore:"author"`
 	//editors
 
-	CoverURL  string `firestore:"coverURL""`
+	CoverURL  string `firestore:"coverURL"`
 	Published bool   `firestore:"published"`
 
-	CreatedAt time.Time `firestore:"createdAt.timestampValue"`
-	UpdatedAt time.Time `firestore:"updatedAt.timestampValue"`
+	CreatedAt time.Time `firestore:"createdAt"`
+	UpdatedAt time.Time `firestore:"updatedAt"`
 
 	Description string   `firestore:"description"`
 	Genres      []Genre  `firestore:"genres"`
@@ -64,10 +43,15 @@ type Novel struct {
 	WorldRating int64 `firestore:"worldRating"`
 	GrammRating int64 `firestore:"grammRating"`
 }
+
+// Author is the author of a novel, denormalized from `users` collection
 type Author struct {
-	Uid         string `firestore:"uid"`
+	UID         string `firestore:"uid"`
 	DisplayName string `firestore:"displayName"`
+	PhotoURL    string `firestore:"photoURL,omitempty"`
 }
+
+// Genre is a genre of a novel, denormalized from `genres` collection
 type Genre struct {
 	Name        string `firestore:"name"`
 	Description string `firestore:"description"`
@@ -99,16 +83,36 @@ func init() {
 }
 
 // OnNovelCreate executes when a document in `novels` collection is created
-func OnNovelCreate(ctx context.Context, e FirestoreEvent) error {
-	meta, err := metadata.FromContext(ctx)
+func OnNovelCreate(ctx context.Context, e gcp.FirestoreEvent) error {
+	resource, err := gcp.ResourceFromContext(ctx)
 	if err != nil {
-		log.Fatalf("metadata.FromContext: %v", err)
+		log.Printf("gcp.ResourceFromContext: %v", err)
+		return err
 	}
-	log.Printf("Function triggered by change to: %v", meta.Resource)
-	log.Printf("ID direct: %v", e.Value.Fields.Id)
-	log.Printf("ID child: %v", e.Value.Fields.Id.StringValue)
-	log.Printf("Title direct: %s", e.Value.Fields.Title)
-	log.Printf("Title child: %s", e.Value.Fields.Title.StringValue)
+	log.Printf("Function triggered by change to: %v", resource)
+
+	params, ok := resource.Match(novelPattern)
+	if !ok {
+		log.Printf("unexpected trigger resource: %v", resource)
+		return nil // No use retrying, result won't change
+	}
+
+	var novel Novel
+	if err := e.Value.DataTo(&novel); err != nil {
+		log.Printf("decoding value: %v", err.Error())
+		return nil // No use retrying, result won't change
+	}
+	log.Printf("ID: %v (document %v)", novel.ID, params["novelId"])
+	log.Printf("Title: %s", novel.Title)
+	log.Printf("Author: %s", novel.Author.DisplayName)
 
 	return nil
 }
+
+// onNovelCreateCloudEvent adapts OnNovelCreate to CloudEvents
+var onNovelCreateCloudEvent = cloudevents.MustHandler(OnNovelCreate)
+
+// OnNovelCreateCloudEvent is the entry point of OnNovelCreate for runtimes delivering CloudEvents over HTTP.
+func OnNovelCreateCloudEvent(w http.ResponseWriter, r *http.Request) {
+	onNovelCreateCloudEvent.ServeHTTP(w, r)
+}
@@ -0,0 +1,96 @@
+package update
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	firebase "firebase.google.com/go"
+	"github.com/makuc/a-novels-backend/pkg/denorm"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+	"github.com/makuc/a-novels-backend/pkg/gcp/cloudevents"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
+)
+
+var (
+	client *firestore.Client
+	leases *idempotent.FirestoreStore
+	engine *denorm.Engine
+)
+
+// propagations declares where fields of novels are denormalized into
+var propagations = newPropagations()
+
+func newPropagations() *denorm.Registry {
+	r := denorm.NewRegistry()
+	r.Register(denorm.Propagation{
+		Name:       "chapters",
+		Source:     "novels/{novelId}",
+		Fields:     map[string]string{"title": "novel.title"},
+		Collection: "novels/{novelId}/chapters",
+	})
+	r.Register(denorm.Propagation{
+		Name:       "reviews",
+		Source:     "novels/{novelId}",
+		Fields:     map[string]string{"title": "novel.title"},
+		Collection: "novels/{novelId}/reviews",
+	})
+	return r
+}
+
+func init() {
+	ctx := context.Background()
+
+	projectID, ok := os.LookupEnv("GPC_PROJECT")
+	if !ok {
+		projectID = "testing-192515"
+	}
+
+	// Initialize the app with a custom auth variable, limiting the server's access
+	uid, ok := os.LookupEnv("worker_id")
+	if !ok {
+		log.Fatalf("set env variable `worker_id`")
+	}
+	ao := map[string]interface{}{
+		"uid": uid,
+	}
+	conf := &firebase.Config{
+		ProjectID:    projectID,
+		AuthOverride: &ao,
+	}
+	// Initialize default app
+	app, err := firebase.NewApp(ctx, conf)
+	if err != nil {
+		log.Fatalf("firebase.NewApp: %v\n", err)
+	}
+	// Access firestore service from the default app
+	client, err = app.Firestore(ctx)
+	if err != nil {
+		log.Fatalf("app.Firestore: %v", err)
+	}
+
+	collection, ok := os.LookupEnv("leaseCollection")
+	if !ok {
+		collection = "novel-events"
+	}
+	leases = idempotent.NewFirestoreStore(client, collection)
+	engine = denorm.NewEngine(client, leases, propagations)
+}
+
+// OnNovelUpdate executes when a novel is UPDATED, copying its changed fields wherever they're denormalized
+func OnNovelUpdate(ctx context.Context, e gcp.FirestoreEvent) error {
+	if !propagations.Triggered(e) {
+		return nil // nothing to adjust
+	}
+	return idempotent.Wrap(ctx, leases, e, engine.Handler(e))
+}
+
+// onNovelUpdateCloudEvent adapts OnNovelUpdate to CloudEvents
+var onNovelUpdateCloudEvent = cloudevents.MustHandler(OnNovelUpdate)
+
+// OnNovelUpdateCloudEvent is the entry point of OnNovelUpdate for runtimes delivering CloudEvents over HTTP.
+func OnNovelUpdateCloudEvent(w http.ResponseWriter, r *http.Request) {
+	onNovelUpdateCloudEvent.ServeHTTP(w, r)
+}
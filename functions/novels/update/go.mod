@@ -0,0 +1,12 @@
+module github.com/makuc/a-novels-backend/functions/novels/update
+
+go 1.12
+
+require (
+	cloud.google.com/go/firestore v1.1.0
+	firebase.google.com/go v3.10.0+incompatible
+	github.com/makuc/a-novels-backend v0.0.0
+	google.golang.org/api v0.14.0
+)
+
+replace github.com/makuc/a-novels-backend => ../../..
@@ -4,30 +4,16 @@ import (
 	"cloud.google.com/go/firestore"
 	"context"
 	firebase "firebase.google.com/go"
+	"github.com/makuc/a-novels-backend/pkg/gcp/auth"
+	"github.com/makuc/a-novels-backend/pkg/gcp/cloudevents"
 	"log"
+	"net/http"
 	"os"
-	"strings"
 	"time"
 )
 
 var client *firestore.Client
 
-// AuthEvent is payload event from Firebase
-type AuthEvent struct {
-	UID           string `json:"uid"`
-	DisplayName   string `json:"displayName"`
-	Email         string `json:"email"`
-	EmailVerified bool   `json:"emailVerified"`
-	PhoneNumber   string `json:"phoneNumber"`
-	PhotoURL      string `json:"photoURL"`
-
-	Metadata struct {
-		CreatedAt      time.Time `json:"createdAt"`
-		CreationTime   time.Time `json:"creationTime"`
-		LastSignInTime time.Time `json:"lastSignInTime"`
-	} `json:"metadata"`
-}
-
 // UserProfile is a payload event from Firebase
 type UserProfile struct {
 	UID           string `firestore:"uid"`
@@ -68,21 +54,17 @@ func init() {
 
 // OnUserCreate executes upon a new user being with Firebase Auth
 // It creates a copy for storing custom user info in DB.
-func OnUserCreate(ctx context.Context, e AuthEvent) error {
-	if e.DisplayName == "" {
-		e.DisplayName = e.Email[:strings.Index(e.Email, "@")]
-	}
-
+func OnUserCreate(ctx context.Context, e auth.AuthEvent) error {
 	// Create the new user document
 	_, err := client.Collection("users").Doc(e.UID).Set(ctx, UserProfile{
 		UID:           e.UID,
-		DisplayName:   e.DisplayName,
+		DisplayName:   e.DefaultDisplayName(),
 		Email:         e.Email,
 		EmailVerified: e.EmailVerified,
 		PhoneNumber:   e.PhoneNumber,
 		PhotoURL:      e.PhotoURL,
 
-		CreatedAt: e.Metadata.CreatedAt,
+		CreatedAt: e.Metadata.Created(),
 	})
 	if err != nil {
 		log.Fatalf("users.Add: %v", err)
@@ -90,3 +72,11 @@ func OnUserCreate(ctx context.Context, e AuthEvent) error {
 
 	return nil
 }
+
+// onUserCreateCloudEvent adapts OnUserCreate to CloudEvents
+var onUserCreateCloudEvent = cloudevents.MustHandler(OnUserCreate)
+
+// OnUserCreateCloudEvent is the entry point of OnUserCreate for runtimes delivering CloudEvents over HTTP.
+func OnUserCreateCloudEvent(w http.ResponseWriter, r *http.Request) {
+	onUserCreateCloudEvent.ServeHTTP(w, r)
+}
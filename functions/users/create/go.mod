@@ -3,6 +3,10 @@ module github.com/makuc/a-novels-backend/functions/users/create
 go 1.12
 
 require (
-	cloud.google.com/go v0.41.0
-	firebase.google.com/go v3.8.1+incompatible
+	cloud.google.com/go v0.49.0
+	cloud.google.com/go/firestore v1.1.0
+	firebase.google.com/go v3.10.0+incompatible
+	github.com/makuc/a-novels-backend v0.0.0
 )
+
+replace github.com/makuc/a-novels-backend => ../../..
@@ -0,0 +1,238 @@
+package delete
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
+	ibatch "github.com/makuc/a-novels-backend/pkg/idempotent/batch"
+	"google.golang.org/api/iterator"
+)
+
+// stepSize is the number of documents written in a single batch (batch write MAX is: 500)
+const stepSize = 400
+
+// anonymousName replaces display name of deleted authors, when their content is kept
+const anonymousName = "Deleted user"
+
+// deletePolicy decides what happens with content a deleted user authored, configured with env variable `deletePolicy`
+type deletePolicy string
+
+const (
+	policyDelete    deletePolicy = "delete"    // content is deleted
+	policyAnonymize deletePolicy = "anonymize" // content is kept, without the author
+)
+
+func parsePolicy(raw string) (deletePolicy, error) {
+	switch p := deletePolicy(raw); p {
+	case policyDelete, policyAnonymize:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown policy %q, use %q or %q", raw, policyDelete, policyAnonymize)
+}
+
+// anonymousAuthor overwrites `author` snapshot of kept content
+var anonymousAuthor = map[string]interface{}{
+	"author": map[string]interface{}{
+		"uid":         firestore.Delete,
+		"displayName": anonymousName,
+		"photoURL":    firestore.Delete,
+	},
+}
+
+// process writes changes for a single document, which must make it no longer match the query of its step
+type process func(ctx context.Context, batch *firestore.WriteBatch, doc *firestore.DocumentSnapshot) error
+
+// deleteAccount executes the cascade for user uid, step by step. Every step is checkpointed once done,
+// so a retry only continues with the remaining ones.
+func deleteAccount(ctx context.Context, lease *idempotent.Lease, uid string) error {
+	deadline := idempotent.Deadline(ctx)
+	user := client.Collection("users").Doc(uid)
+
+	authored, novels := process(deleteDocument), process(deleteNovel)
+	if policy == policyAnonymize {
+		authored, novels = anonymize, anonymize
+	}
+
+	steps := []struct {
+		name    string
+		query   firestore.Query
+		process process
+	}{
+		{"favorites", user.Collection("favorites").Query, deleteDocument},
+		{"progress", user.Collection("progress").Query, deleteDocument},
+		{"reviews", client.CollectionGroup("reviews").Where("author.uid", "==", uid), authored},
+		{"novels", client.Collection("novels").Where("author.uid", "==", uid), novels},
+		{"exports", jobs.Where("uid", "==", uid), deleteDocument},
+	}
+	for _, s := range steps {
+		if err := drain(ctx, lease, deadline, s.name, s.query, s.process); err != nil {
+			log.Printf("step %v: %v", s.name, err)
+			return err
+		}
+	}
+
+	// Files uploaded by the user, and archives of the user's data exports
+	cp, err := idempotent.GetCheckpoint(ctx, leases, "storage")
+	if err != nil {
+		return err
+	}
+	if !cp.Done {
+		for _, prefix := range []string{"users/" + uid + "/", "exports/" + uid + "/"} {
+			if err := deleteObjects(ctx, deadline, prefix); err != nil {
+				log.Printf("step storage: %v", err)
+				return err
+			}
+		}
+		cp.Done = true
+		if err := idempotent.SaveCheckpoint(ctx, leases, lease, cp); err != nil {
+			return err
+		}
+	}
+
+	// Profile is removed last, so the user can be recognized until everything else is gone
+	if _, err := user.Delete(ctx); err != nil {
+		log.Printf("users.Delete: %v", err)
+		return err
+	}
+	return nil
+}
+
+// drain applies process to all the documents matching query, page by page, until none are left. Since
+// processed documents don't match anymore, every page starts at the beginning, without a cursor.
+// Number of processed documents is saved in checkpoint step together with each page.
+func drain(ctx context.Context, lease *idempotent.Lease, deadline time.Time, step string, query firestore.Query, p process) error {
+	cp, err := idempotent.GetCheckpoint(ctx, leases, step)
+	if err != nil {
+		return err // corrupt, reported as such
+	}
+
+	for !cp.Done {
+		if time.Now().After(deadline) {
+			return idempotent.ErrDeadlineNear // retried, continuing from the checkpoint
+		}
+
+		docs, err := query.Limit(stepSize).Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+
+		// Processing a document can take a while (e.g. deleting a novel), so stop early if needed
+		batch := client.Batch()
+		processed := 0
+		for _, doc := range docs {
+			if time.Now().After(deadline) {
+				break
+			}
+			if err := p(ctx, batch, doc); err != nil {
+				return err
+			}
+			processed++
+		}
+
+		count, _ := cp.Int("count")
+		cp.State["count"] = count + int64(processed)
+		if len(docs) < stepSize && processed == len(docs) {
+			cp.Done = true // We are done here
+		}
+
+		if err := ibatch.SaveCheckpointBatch(ctx, leases, lease, batch, cp); err != nil {
+			return err // lease was taken over by another execution
+		}
+		err = ibatch.CommitBatch(ctx, leases, lease, batch)
+		if err == ibatch.ErrProgressConflict {
+			// Nothing was written, so continue from the saved checkpoint
+			if cp, err = idempotent.GetCheckpoint(ctx, leases, step); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteDocument(ctx context.Context, batch *firestore.WriteBatch, doc *firestore.DocumentSnapshot) error {
+	batch.Delete(doc.Ref)
+	return nil
+}
+
+func anonymize(ctx context.Context, batch *firestore.WriteBatch, doc *firestore.DocumentSnapshot) error {
+	batch.Set(doc.Ref, anonymousAuthor, firestore.MergeAll)
+	return nil
+}
+
+// deleteNovel deletes the novel along with its subcollections (chapters, reviews, ...) and files.
+// The novel itself is deleted last with the batch, so it's found again if anything fails meanwhile.
+func deleteNovel(ctx context.Context, batch *firestore.WriteBatch, doc *firestore.DocumentSnapshot) error {
+	if err := deleteObjects(ctx, time.Time{}, "novels/"+doc.Ref.ID+"/"); err != nil {
+		return err
+	}
+	if err := deleteCollections(ctx, doc.Ref); err != nil {
+		return err
+	}
+	batch.Delete(doc.Ref)
+	return nil
+}
+
+// deleteCollections recursively deletes all the subcollections of ref.
+func deleteCollections(ctx context.Context, ref *firestore.DocumentRef) error {
+	iter := ref.Collections(ctx)
+	for {
+		coll, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for {
+			docs, err := coll.Limit(stepSize).Documents(ctx).GetAll()
+			if err != nil {
+				return err
+			}
+			if len(docs) == 0 {
+				break
+			}
+			batch := client.Batch()
+			for _, doc := range docs {
+				if err := deleteCollections(ctx, doc.Ref); err != nil {
+					return err
+				}
+				batch.Delete(doc.Ref)
+			}
+			if _, err := batch.Commit(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// deleteObjects deletes all the objects with name starting with prefix. Zero deadline means none.
+func deleteObjects(ctx context.Context, deadline time.Time, prefix string) error {
+	it := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return idempotent.ErrDeadlineNear
+		}
+
+		err = bucket.Object(attrs.Name).Delete(ctx)
+		if err != nil && err != storage.ErrObjectNotExist {
+			return err
+		}
+	}
+}
@@ -1,14 +1,29 @@
 package delete
 
 import (
-	"cloud.google.com/go/firestore"
 	"context"
-	firebase "firebase.google.com/go"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	firebase "firebase.google.com/go"
+	"github.com/makuc/a-novels-backend/pkg/gcp/auth"
+	"github.com/makuc/a-novels-backend/pkg/gcp/cloudevents"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
 )
 
-var client *firestore.Client
+var (
+	client *firestore.Client
+	bucket *storage.BucketHandle
+	leases *idempotent.FirestoreStore
+	jobs   *firestore.CollectionRef // export jobs, see ExportUserData
+
+	// policy decides what happens with novels and reviews of deleted users
+	policy = policyAnonymize
+)
 
 func init() {
 	ctx := context.Background()
@@ -18,8 +33,18 @@ func init() {
 		projectID = "testing-192515"
 	}
 
+	// Initialize the app with a custom auth variable, limiting the server's access
+	uid, ok := os.LookupEnv("worker_id")
+	if !ok {
+		log.Fatalf("set env variable `worker_id`")
+	}
+	ao := map[string]interface{}{
+		"uid": uid,
+	}
 	conf := &firebase.Config{
-		ProjectID: projectID,
+		ProjectID:     projectID,
+		StorageBucket: fmt.Sprintf("%s.appspot.com", projectID),
+		AuthOverride:  &ao,
 	}
 
 	// Initialize default app
@@ -33,18 +58,53 @@ func init() {
 	if err != nil {
 		log.Fatalf("app.Firestore: %v", err)
 	}
-}
 
-type AuthEvent struct {
-	UID string `json:"uid"`
+	// Access storage services from the default app
+	storageClient, err := app.Storage(ctx)
+	if err != nil {
+		log.Fatalf("app.Storage: %v", err)
+	}
+	bucket, err = storageClient.DefaultBucket()
+	if err != nil {
+		log.Fatalf("storageClient.DefaultBucket: %v", err)
+	}
+
+	collection, ok := os.LookupEnv("leaseCollection")
+	if !ok {
+		collection = "user-delete-events"
+	}
+	leases = idempotent.NewFirestoreStore(client, collection)
+
+	jobsCollection, ok := os.LookupEnv("jobsCollection")
+	if !ok {
+		jobsCollection = "exports"
+	}
+	jobs = client.Collection(jobsCollection)
+
+	if raw, ok := os.LookupEnv("deletePolicy"); ok {
+		if policy, err = parsePolicy(raw); err != nil {
+			log.Fatalf("check env: deletePolicy: %v", err)
+		}
+	}
 }
 
-func OnUserDelete(ctx context.Context, e AuthEvent) error {
-	// Remove the obsolete user document
-	_, err := client.Collection("users").Doc(e.UID).Delete(ctx)
-	if err != nil {
-		log.Fatalf("users.Delete: %v", err)
+// OnUserDelete executes when a user is deleted from Firebase Auth, removing (or anonymizing) everything
+// that belongs to the user. See README for the steps of the cascade.
+func OnUserDelete(ctx context.Context, e auth.AuthEvent) error {
+	if e.UID == "" {
+		log.Printf("event without uid")
+		return nil // No use retrying, result won't change
 	}
 
-	return nil
+	return idempotent.Wrap(ctx, leases, e, func(ctx context.Context, lease *idempotent.Lease) error {
+		return deleteAccount(ctx, lease, e.UID)
+	})
+}
+
+// onUserDeleteCloudEvent adapts OnUserDelete to CloudEvents
+var onUserDeleteCloudEvent = cloudevents.MustHandler(OnUserDelete)
+
+// OnUserDeleteCloudEvent is the entry point of OnUserDelete for runtimes delivering CloudEvents over HTTP.
+func OnUserDeleteCloudEvent(w http.ResponseWriter, r *http.Request) {
+	onUserDeleteCloudEvent.ServeHTTP(w, r)
 }
@@ -0,0 +1,165 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// exportedDoc is a document as written into the archive
+type exportedDoc struct {
+	Path string                 `json:"path"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// writeArchive writes all the personal data of user uid into object, as a ZIP archive with:
+//
+//	profile.json   users/{uid}
+//	novels.json    novels authored by the user
+//	reviews.json   reviews written by the user
+//	files/...      objects under `users/{uid}/` and `novels/{novelId}/` of the authored novels
+//
+// The object is only created if everything was written.
+func writeArchive(ctx context.Context, uid string, object string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // aborts the upload, unless closed already
+
+	ow := bucket.Object(object).NewWriter(ctx)
+	ow.ContentType = "application/zip"
+	zw := zip.NewWriter(ow)
+
+	profile, err := client.Collection("users").Doc(uid).Get(ctx)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "profile.json", exportDoc(profile)); err != nil {
+		return err
+	}
+
+	novels, err := client.Collection("novels").Where("author.uid", "==", uid).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "novels.json", exportDocs(novels)); err != nil {
+		return err
+	}
+
+	reviews, err := client.CollectionGroup("reviews").Where("author.uid", "==", uid).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "reviews.json", exportDocs(reviews)); err != nil {
+		return err
+	}
+
+	prefixes := []string{"users/" + uid + "/"}
+	for _, novel := range novels {
+		prefixes = append(prefixes, "novels/"+novel.Ref.ID+"/")
+	}
+	for _, prefix := range prefixes {
+		if err := writeObjects(ctx, zw, prefix); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return ow.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeObjects copies all the objects with name starting with prefix into `files/` of the archive.
+func writeObjects(ctx context.Context, zw *zip.Writer, prefix string) error {
+	it := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		r, err := bucket.Object(attrs.Name).NewReader(ctx)
+		if err == storage.ErrObjectNotExist {
+			continue // deleted meanwhile
+		}
+		if err != nil {
+			return err
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     path.Join("files", attrs.Name),
+			Method:   zip.Store, // media is compressed already
+			Modified: attrs.Updated,
+		})
+		if err == nil {
+			_, err = io.Copy(w, r)
+		}
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func exportDocs(docs []*firestore.DocumentSnapshot) []exportedDoc {
+	exported := make([]exportedDoc, len(docs))
+	for i, doc := range docs {
+		exported[i] = exportDoc(doc)
+	}
+	return exported
+}
+
+func exportDoc(doc *firestore.DocumentSnapshot) exportedDoc {
+	return exportedDoc{
+		Path: doc.Ref.Path,
+		Data: plainValue(doc.Data()).(map[string]interface{}),
+	}
+}
+
+// plainValue converts values read by the Firestore client into values encoding to JSON nicely:
+// references into their paths and geo points into `latitude` and `longitude`.
+func plainValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *firestore.DocumentRef:
+		if v == nil {
+			return nil
+		}
+		return v.Path
+	case *latlng.LatLng:
+		if v == nil {
+			return nil
+		}
+		return map[string]float64{"latitude": v.GetLatitude(), "longitude": v.GetLongitude()}
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, elem := range v {
+			array[i] = plainValue(elem)
+		}
+		return array
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			m[k] = plainValue(elem)
+		}
+		return m
+	}
+	return v
+}
@@ -0,0 +1,249 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	firebase "firebase.google.com/go"
+	"firebase.google.com/go/auth"
+)
+
+var (
+	client     *firestore.Client
+	authClient *auth.Client
+	bucket     *storage.BucketHandle
+	bucketName string
+	jobs       *firestore.CollectionRef
+
+	// linkDuration is how long download links stay valid, and archives are kept for
+	linkDuration = 24 * time.Hour
+	// allowedOrigin is allowed to call the function from browsers (CORS)
+	allowedOrigin = "*"
+)
+
+// Export job statuses
+const (
+	statusRunning = "running"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+// jobTimeout is the function timeout (see Makefile), after which running jobs can't complete anymore
+const jobTimeout = 540 * time.Second
+
+func init() {
+	ctx := context.Background()
+
+	projectID, ok := os.LookupEnv("GPC_PROJECT")
+	if !ok {
+		projectID = "testing-192515"
+	}
+
+	// Initialize the app with a custom auth variable, limiting the server's access
+	uid, ok := os.LookupEnv("worker_id")
+	if !ok {
+		log.Fatalf("set env variable `worker_id`")
+	}
+	ao := map[string]interface{}{
+		"uid": uid,
+	}
+	bucketName = fmt.Sprintf("%s.appspot.com", projectID)
+	conf := &firebase.Config{
+		ProjectID:     projectID,
+		StorageBucket: bucketName,
+		AuthOverride:  &ao,
+	}
+
+	// Initialize default app
+	app, err := firebase.NewApp(ctx, conf)
+	if err != nil {
+		log.Fatalf("firebase.NewApp: %v\n", err)
+	}
+
+	// Access firestore service from the default app
+	client, err = app.Firestore(ctx)
+	if err != nil {
+		log.Fatalf("app.Firestore: %v", err)
+	}
+
+	// Access auth service from the default app, for verifying ID tokens
+	authClient, err = app.Auth(ctx)
+	if err != nil {
+		log.Fatalf("app.Auth: %v", err)
+	}
+
+	// Access storage services from the default app
+	storageClient, err := app.Storage(ctx)
+	if err != nil {
+		log.Fatalf("app.Storage: %v", err)
+	}
+	bucket, err = storageClient.DefaultBucket()
+	if err != nil {
+		log.Fatalf("storageClient.DefaultBucket: %v", err)
+	}
+
+	collection, ok := os.LookupEnv("jobsCollection")
+	if !ok {
+		collection = "exports"
+	}
+	jobs = client.Collection(collection)
+
+	if raw, ok := os.LookupEnv("linkHours"); ok {
+		hours, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || hours <= 0 || hours > 7*24 {
+			log.Fatalf("check env: linkHours, must be between 1 and 168")
+		}
+		linkDuration = time.Duration(hours) * time.Hour
+	}
+	if origin, ok := os.LookupEnv("allowedOrigin"); ok {
+		allowedOrigin = origin
+	}
+}
+
+// exportResponse is returned once the export is written
+type exportResponse struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ExportUserData exports personal data of the calling user, identified by Firebase ID token in the
+// `Authorization: Bearer <token>` header, into a ZIP archive in Storage. It responds with a download
+// link, valid for `linkHours`. Every export is tracked as a job in `jobsCollection`.
+func ExportUserData(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", http.MethodPost)
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	uid, err := verifyCaller(ctx, r)
+	if err != nil {
+		log.Printf("verifyCaller: %v", err)
+		http.Error(w, "invalid or missing ID token", http.StatusUnauthorized)
+		return
+	}
+
+	failStaleJobs(ctx, uid)
+
+	// Jobs are removed by TTL policy on `expireAt`, even if they never complete
+	job := jobs.NewDoc()
+	object := fmt.Sprintf("exports/%v/%v.zip", uid, job.ID)
+	_, err = job.Set(ctx, map[string]interface{}{
+		"uid":       uid,
+		"status":    statusRunning,
+		"object":    object,
+		"createdAt": firestore.ServerTimestamp,
+		"expireAt":  time.Now().Add(jobTimeout + linkDuration),
+	})
+	if err != nil {
+		log.Printf("creating job: %v", err)
+		http.Error(w, "export failed", http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := export(ctx, uid, object)
+	if err != nil {
+		log.Printf("export %v: %v", job.ID, err)
+		failJob(job, err)
+		http.Error(w, "export failed", http.StatusInternalServerError)
+		return
+	}
+	resp.ID = job.ID
+
+	_, err = job.Set(ctx, map[string]interface{}{
+		"status":      statusDone,
+		"expiresAt":   resp.ExpiresAt,
+		"expireAt":    resp.ExpiresAt, // No use keeping the job once the link expires
+		"completedAt": firestore.ServerTimestamp,
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("completing job %v: %v", job.ID, err) // export is ready regardless
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("writing response: %v", err)
+	}
+}
+
+// verifyCaller returns uid of the user calling the function, based on the ID token.
+func verifyCaller(ctx context.Context, r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", errors.New("no bearer token")
+	}
+	token, err := authClient.VerifyIDTokenAndCheckRevoked(ctx, strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		return "", err
+	}
+	return token.UID, nil
+}
+
+// export writes the archive into object and signs a link for downloading it.
+func export(ctx context.Context, uid string, object string) (*exportResponse, error) {
+	if err := writeArchive(ctx, uid, object); err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(linkDuration)
+	url, err := signedURL(ctx, object, expires)
+	if err != nil {
+		return nil, err
+	}
+	return &exportResponse{URL: url, ExpiresAt: expires}, nil
+}
+
+// failJob records cause with the job. It doesn't use the request's context, which may already be done.
+func failJob(job *firestore.DocumentRef, cause error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := job.Set(ctx, map[string]interface{}{
+		"status":      statusFailed,
+		"error":       cause.Error(),
+		"completedAt": firestore.ServerTimestamp,
+	}, firestore.MergeAll)
+	if err != nil {
+		log.Printf("failing job %v: %v", job.ID, err)
+	}
+}
+
+// failStaleJobs marks running jobs of user uid, which should have completed by now, as failed. Their execution
+// was stopped (e.g. by the timeout), without failing them.
+func failStaleJobs(ctx context.Context, uid string) {
+	running, err := jobs.Where("uid", "==", uid).Where("status", "==", statusRunning).Documents(ctx).GetAll()
+	if err != nil {
+		log.Printf("fetching running jobs of %v: %v", uid, err)
+		return // only affects the listed status of old jobs, carry on
+	}
+	for _, doc := range running {
+		if doc.CreateTime.After(time.Now().Add(-jobTimeout)) {
+			continue // may still complete
+		}
+		_, err := doc.Ref.Set(ctx, map[string]interface{}{
+			"status":      statusFailed,
+			"error":       "timed out",
+			"completedAt": firestore.ServerTimestamp,
+		}, firestore.MergeAll)
+		if err != nil {
+			log.Printf("failing stale job %v: %v", doc.Ref.ID, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/makuc/a-novels-backend/functions/users/export
+
+go 1.12
+
+require (
+	cloud.google.com/go v0.49.0
+	cloud.google.com/go/firestore v1.1.0
+	cloud.google.com/go/storage v1.0.0
+	firebase.google.com/go v3.10.0+incompatible
+	google.golang.org/api v0.14.0
+	google.golang.org/genproto v0.0.0-20191115194625-c23dd37a84c9
+)
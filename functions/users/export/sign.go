@@ -0,0 +1,47 @@
+package export
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iamcredentials/v1"
+)
+
+// signedURL returns a link for downloading object until expires. Functions don't have a private key
+// of their service account, so the URL is signed by IAM Credentials API instead (requires role
+// `roles/iam.serviceAccountTokenCreator` on the service account).
+func signedURL(ctx context.Context, object string, expires time.Time) (string, error) {
+	email, ok := os.LookupEnv("serviceAccount")
+	if !ok {
+		var err error
+		if email, err = metadata.Email("default"); err != nil {
+			return "", err
+		}
+	}
+
+	iam, err := iamcredentials.NewService(ctx)
+	if err != nil {
+		return "", err
+	}
+	name := "projects/-/serviceAccounts/" + email
+
+	return storage.SignedURL(bucketName, object, &storage.SignedURLOptions{
+		GoogleAccessID: email,
+		Method:         "GET",
+		Expires:        expires,
+		Scheme:         storage.SigningSchemeV4,
+		SignBytes: func(b []byte) ([]byte, error) {
+			resp, err := iam.Projects.ServiceAccounts.SignBlob(name, &iamcredentials.SignBlobRequest{
+				Payload: base64.StdEncoding.EncodeToString(b),
+			}).Context(ctx).Do()
+			if err != nil {
+				return nil, err
+			}
+			return base64.StdEncoding.DecodeString(resp.SignedBlob)
+		},
+	})
+}
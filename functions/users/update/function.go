@@ -3,46 +3,51 @@ package update
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
-	"time"
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
+	"github.com/makuc/a-novels-backend/pkg/denorm"
 	"github.com/makuc/a-novels-backend/pkg/gcp"
+	"github.com/makuc/a-novels-backend/pkg/gcp/cloudevents"
 	"github.com/makuc/a-novels-backend/pkg/idempotent"
-	"google.golang.org/api/iterator"
 )
 
 var (
 	client *firestore.Client
+	leases *idempotent.FirestoreStore
+	engine *denorm.Engine
 )
 
-// FirestoreEvent is the payload of a Firestore event.
-type FirestoreEvent struct {
-	// OldValue   		UnknownValues	`json:"oldValue"`
-	OldValue   FirestoreValue `json:"oldValue"`
-	Value      FirestoreValue `firestore:"value"`
-	UpdateMask gcp.FieldPaths `firestore:"updateMask"`
+// authorFields are public fields of user profiles, copied into the `author` snapshot wherever
+// the user authored something. Add new public fields here and they're propagated in the same pass.
+var authorFields = map[string]string{
+	"displayName": "author.displayName",
+	"photoURL":    "author.photoURL",
 }
 
-// FirestoreValue holds Firestore fields.
-type FirestoreValue struct {
-	CreateTime time.Time `json:"createTime"`
-	// Fields is the data for this value.
-	Fields     UserProfile `json:"fields"`
-	Name       string      `json:"name"`
-	UpdateTime time.Time   `json:"updateTime"`
-}
-
-// UserProfile is a struct containing field for UserProfile
-type UserProfile struct {
-	UID         gcp.StringValue `json:"uid"`
-	DisplayName gcp.StringValue `json:"displayName"`
-	Email       gcp.StringValue `json:"email"`
-	//EmailVerified
-	PhoneNumber gcp.StringValue    `json:"phoneNumber"`
-	PhotoURL    gcp.StringValue    `json:"photoURL"`
-	CreatedAt   gcp.TimestampValue `json:"createdAt"`
+// propagations declares where fields of user profiles are denormalized into
+var propagations = newPropagations()
+
+func newPropagations() *denorm.Registry {
+	r := denorm.NewRegistry()
+	r.Register(denorm.Propagation{
+		Name:       "novels",
+		Source:     "users/{uid}",
+		Fields:     authorFields,
+		Collection: "novels",
+		Key:        "author.uid",
+	})
+	r.Register(denorm.Propagation{
+		Name:       "reviews",
+		Source:     "users/{uid}",
+		Fields:     authorFields,
+		Collection: "reviews",
+		Group:      true,
+		Key:        "author.uid",
+	})
+	return r
 }
 
 func init() {
@@ -75,237 +80,31 @@ func init() {
 	if err != nil {
 		log.Fatalf("app.Firestore: %v", err)
 	}
-	idempotent.Client = client
-}
-
-// OnUserUpdate executes when relevant entry in User collection is UPDATED
-func OnUserUpdate(ctx context.Context, e FirestoreEvent) error {
-	// log.Printf("Function triggered by change to: %v", meta.Resource)
-
-	proceed, err := idempotent.ExecuteWithLease(ctx)
-	if err != nil {
-		log.Printf("ExecuteWithLease: %v", err.Error())
-		return err
-	}
-	if !proceed {
-		return nil // this means this EventID was already completed
-	}
-
-	// Continue with execution
-	if e.OldValue.Fields.DisplayName.StringValue != e.Value.Fields.DisplayName.StringValue {
-		// Display name has been changed! Now do the correct adjustments!
-		err := changeNovelAuthor(ctx, e.Value.Fields.UID.StringValue, e.Value.Fields.DisplayName.StringValue)
-		if err != nil {
-			log.Printf("changeNovelsAuthor: %v", err.Error())
-			return err
-		}
-
-		err = changeReviewsAuthor(ctx, e.Value.Fields.UID.StringValue, e.Value.Fields.DisplayName.StringValue)
-		if err != nil {
-			log.Printf("changeReviewsAuthor: %v", err.Error())
-			return err
-		}
-	}
-
-	return idempotent.ExecuteMarkComplete(ctx)
-}
 
-func changeNovelAuthor(ctx context.Context, uid string, name string) error {
-	progressRef, err := idempotent.GetExecuteProgressRef(ctx)
-	if err != nil {
-		return err
-	}
-
-	doc, err := progressRef.Get(ctx)
-	if err != nil {
-		return err
-	}
-
-	// Fetch time the event was executed, to only affect older docs
-	rawData := doc.Data()
-	novelsDone := false
-	novelsDoneRaw, ok := rawData["novelsDone"]
-	if ok {
-		novelsDone, ok = novelsDoneRaw.(bool)
-		if !ok {
-			log.Print("error asserting type of `novelsDone`")
-		}
-		if novelsDone {
-			return nil // we are done here
-		}
-	}
-
-	createdRaw, ok := rawData["createdAt"]
-	if !ok {
-		log.Printf("`createdAt` doesn't exist")
-		return nil // No use retrying, result won't change
-	}
-	created, ok := createdRaw.(time.Time)
+	collection, ok := os.LookupEnv("leaseCollection")
 	if !ok {
-		log.Printf("error assering type of `createdAt`")
-		return nil // No use retrying here, result won't change
-	}
-
-	// Fetch what was already processed
-	novelsStep := 0
-	novelsStepRaw, ok := rawData["novelsStep"]
-	if ok {
-		novelsStep, ok = novelsStepRaw.(int)
-		if !ok {
-			log.Print("error asserting type of `novelsStep`")
-			return nil // No use retrying here, result won't change
-		}
-	}
-
-	// Determine size of each step (since batch write MAX is: 500)
-	stepSize := 400
-
-	for {
-		queryNovels := client.Collection("novels").
-			Where("author.uid", "==", uid).
-			OrderBy("createdAt", firestore.Desc).
-			Where("createdAt", "<", created).
-			Offset(novelsStep * stepSize).
-			Limit(stepSize)
-
-		// Now we actually execute the rewrite
-		batch := client.Batch()
-		docsAffected := 0
-
-		iter := queryNovels.Documents(ctx)
-		for {
-			doc, err := iter.Next()
-			if err != nil {
-				if err == iterator.Done {
-					break // end of this loop
-				}
-				log.Printf("error iterating documents: %v", err.Error())
-			}
-			updatedData := map[string]interface{}{
-				"author": map[string]interface{}{
-					"uid":         uid,
-					"displayName": name,
-				},
-			}
-			batch.Set(doc.Ref, updatedData, firestore.MergeAll)
-			docsAffected++
-		}
-		iter.Stop()
-
-		// All docs (for this step) processed, save state
-		progressNewValue := map[string]interface{}{
-			"updatedAt":  time.Now(),
-			"novelsStep": novelsStep + 1,
-		}
-
-		if docsAffected == 0 {
-			// We are done here
-			progressNewValue["novelsDone"] = true
-		}
-
-		batch.Set(progressRef, progressNewValue, firestore.MergeAll)
-
-		_, err := batch.Commit(ctx)
-		return err
+		collection = "user-events"
 	}
+	leases = idempotent.NewFirestoreStore(client, collection)
+	engine = denorm.NewEngine(client, leases, propagations)
 }
 
-func changeReviewsAuthor(ctx context.Context, uid string, name string) error {
-	progressRef, err := idempotent.GetExecuteProgressRef(ctx)
-	if err != nil {
-		return err
-	}
-
-	doc, err := progressRef.Get(ctx)
-	if err != nil {
-		return err
-	}
-
-	// Fetch time the event was executed, to only affect older docs
-	rawData := doc.Data()
-	reviewsDone := false
-	reviewsDoneRaw, ok := rawData["reviewsDone"]
-	if ok {
-		reviewsDone, ok = reviewsDoneRaw.(bool)
-		if !ok {
-			log.Print("error asserting type of `reviewsDone`")
-		}
-		if reviewsDone {
-			return nil // we are done here
-		}
-	}
-
-	createdRaw, ok := rawData["createdAt"]
-	if !ok {
-		log.Printf("`createdAt` doesn't exist")
-		return nil // No use retrying, result won't change
-	}
-	created, ok := createdRaw.(time.Time)
-	if !ok {
-		log.Printf("error assering type of `createdAt`")
-		return nil // No use retrying here, result won't change
-	}
+// OnUserUpdate executes when relevant entry in User collection is UPDATED
+func OnUserUpdate(ctx context.Context, e gcp.FirestoreEvent) error {
+	// log.Printf("Function triggered by change to: %v", meta.Resource)
 
-	// Fetch what was already processed
-	reviewsStep := 0
-	reviewsStepRaw, ok := rawData["reviewsStep"]
-	if ok {
-		reviewsStep, ok = reviewsStepRaw.(int)
-		if !ok {
-			log.Print("error asserting type of `reviewsStep`")
-			return nil // No use retrying here, result won't change
-		}
+	if !propagations.Triggered(e) {
+		return nil // nothing to adjust
 	}
 
-	// Determine size of each step (since batch write MAX is: 500)
-	stepSize := 400
-
-	for {
-		query := client.CollectionGroup("reviews").
-			Where("author.uid", "==", uid).
-			OrderBy("createdAt", firestore.Desc).
-			Where("createdAt", "<", created).
-			Offset(reviewsStep * stepSize).
-			Limit(stepSize)
-
-		// Now we actually execute the rewrite
-		batch := client.Batch()
-		docsAffected := 0
-
-		iter := query.Documents(ctx)
-		for {
-			doc, err := iter.Next()
-			if err != nil {
-				if err == iterator.Done {
-					break // end of this loop
-				}
-				log.Printf("error iterating documents: %v", err.Error())
-			}
-			updatedData := map[string]interface{}{
-				"author": map[string]interface{}{
-					"uid":         uid,
-					"displayName": name,
-				},
-			}
-			batch.Set(doc.Ref, updatedData, firestore.MergeAll)
-			docsAffected++
-		}
-		iter.Stop()
-
-		// All docs (for this step) processed, save state
-		progressNewValue := map[string]interface{}{
-			"updatedAt":   time.Now(),
-			"reviewsStep": reviewsStep + 1,
-		}
-
-		if docsAffected == 0 {
-			// We are done here
-			progressNewValue["reviewsDone"] = true
-		}
+	// Profile has been changed! Now do the correct adjustments!
+	return idempotent.Wrap(ctx, leases, e, engine.Handler(e))
+}
 
-		batch.Set(progressRef, progressNewValue, firestore.MergeAll)
+// onUserUpdateCloudEvent adapts OnUserUpdate to CloudEvents
+var onUserUpdateCloudEvent = cloudevents.MustHandler(OnUserUpdate)
 
-		_, err := batch.Commit(ctx)
-		return err
-	}
+// OnUserUpdateCloudEvent is the entry point of OnUserUpdate for runtimes delivering CloudEvents over HTTP.
+func OnUserUpdateCloudEvent(w http.ResponseWriter, r *http.Request) {
+	onUserUpdateCloudEvent.ServeHTTP(w, r)
 }
@@ -5,6 +5,8 @@ go 1.12
 require (
 	cloud.google.com/go/firestore v1.1.0
 	firebase.google.com/go v3.10.0+incompatible
-	github.com/makuc/a-novels-backend v0.0.0-20191208233003-b727f2eb66c3
+	github.com/makuc/a-novels-backend v0.0.0
 	google.golang.org/api v0.14.0
 )
+
+replace github.com/makuc/a-novels-backend => ../../..
@@ -12,7 +12,7 @@ $entryPoint = "OnUserUpdate"
 $projectId = "testing-192515"
 $triggerEvent = "providers/cloud.firestore/eventTypes/document.update"
 $triggerResource = "projects/$projectId/databases/(default)/documents/users/{uid}"
-$envVariables = "worker_id=full-admin-rights,leaseSeconds=60"
+$envVariables = "worker_id=full-admin-rights,leaseSeconds=60,leaseCollection=user-events,maxAttempts=5"
 
 # END Config
 
@@ -43,6 +43,7 @@ function deploy {
            --trigger-event $triggerEvent `
            --trigger-resource $triggerResource `
            --entry-point $entryPoint `
+           --retry `
            --runtime=go111 `
            --memory=128MB
 }
@@ -6,5 +6,7 @@ require (
 	cloud.google.com/go v0.49.0
 	cloud.google.com/go/firestore v1.1.0
 	firebase.google.com/go v3.10.0+incompatible // indirect
+	github.com/golang/protobuf v1.3.2
+	google.golang.org/genproto v0.0.0-20191115194625-c23dd37a84c9
 	google.golang.org/grpc v1.25.1
 )
@@ -0,0 +1,150 @@
+package denorm
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
+	ibatch "github.com/makuc/a-novels-backend/pkg/idempotent/batch"
+)
+
+// stepSize is the number of documents rewritten in a single batch (batch write MAX is: 500)
+const stepSize = 400
+
+// Engine runs propagations of a Registry, checkpointing progress of every one of them under the lease,
+// so retried executions continue where the previous one stopped.
+type Engine struct {
+	client   *firestore.Client
+	store    *idempotent.FirestoreStore
+	registry *Registry
+}
+
+// NewEngine returns an Engine writing with client and tracking progress in store.
+func NewEngine(client *firestore.Client, store *idempotent.FirestoreStore, registry *Registry) *Engine {
+	return &Engine{client: client, store: store, registry: registry}
+}
+
+// Run executes all the tasks triggered by event e, one after another. Once the function deadline is near,
+// it stops with idempotent.ErrDeadlineNear.
+func (eng *Engine) Run(ctx context.Context, lease *idempotent.Lease, e gcp.FirestoreEvent) error {
+	tasks, err := eng.registry.Tasks(e)
+	if err != nil {
+		return err
+	}
+	deadline := idempotent.Deadline(ctx)
+	for i := range tasks {
+		if err := eng.propagate(ctx, lease, deadline, &tasks[i]); err != nil {
+			log.Printf("propagating %v: %v", tasks[i].Name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns a handler running the propagations triggered by e, for use with idempotent.Wrap.
+func (eng *Engine) Handler(e gcp.FirestoreEvent) idempotent.Handler {
+	return func(ctx context.Context, lease *idempotent.Lease) error {
+		return eng.Run(ctx, lease, e)
+	}
+}
+
+// propagate writes values of task t into all its target documents created before the execution, page by page.
+// Cursor (the last written document) is saved in the checkpoint together with each page.
+func (eng *Engine) propagate(ctx context.Context, lease *idempotent.Lease, deadline time.Time, t *Task) error {
+	rawData, err := idempotent.GetExecuteProgress(ctx, eng.store)
+	if err != nil {
+		return err
+	}
+
+	// Fetch what was already processed
+	cp, err := idempotent.ParseCheckpoint(rawData, t.Name)
+	if err != nil {
+		return err // corrupt, reported as such
+	}
+
+	// Fetch time the event was executed, to only affect older docs
+	created, ok := rawData["createdAt"].(time.Time)
+	if !ok {
+		return &idempotent.CorruptRecordError{Key: lease.Key, Field: "createdAt", Value: rawData["createdAt"]}
+	}
+
+	// Ordering by document ID too, so documents created at the same time are neither skipped nor repeated
+	query := eng.query(t).
+		Where("createdAt", "<", created).
+		OrderBy("createdAt", firestore.Desc).
+		OrderBy(firestore.DocumentID, firestore.Desc).
+		Limit(stepSize)
+	update := t.Update()
+
+	for !cp.Done {
+		if time.Now().After(deadline) {
+			return idempotent.ErrDeadlineNear // retried, continuing from the checkpoint
+		}
+
+		page := query
+		if path := cp.CursorString(); path != "" {
+			lastCreated, _ := cp.Time("createdAt")
+			page = query.StartAfter(lastCreated, eng.client.Doc(path))
+		}
+		docs, err := page.Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+
+		batch := eng.client.Batch()
+		for _, doc := range docs {
+			batch.Set(doc.Ref, update, firestore.MergeAll)
+		}
+
+		// All docs (for this page) processed, save state
+		if len(docs) < stepSize {
+			cp.Done = true // We are done here
+		}
+		if len(docs) > 0 {
+			last := docs[len(docs)-1]
+			lastCreated, err := last.DataAt("createdAt")
+			if err != nil {
+				return err
+			}
+			resource, err := gcp.ParseResourceName(last.Ref.Path)
+			if err != nil {
+				return err
+			}
+			cp.Cursor = resource.Path
+			cp.State["createdAt"] = lastCreated
+		}
+
+		if err := ibatch.SaveCheckpointBatch(ctx, eng.store, lease, batch, cp); err != nil {
+			return err // lease was taken over by another execution
+		}
+		err = ibatch.CommitBatch(ctx, eng.store, lease, batch)
+		if err == ibatch.ErrProgressConflict {
+			// Nothing was written, so continue from the saved checkpoint
+			if cp, err = idempotent.GetCheckpoint(ctx, eng.store, t.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// query returns the query for target documents of task t.
+func (eng *Engine) query(t *Task) firestore.Query {
+	var query firestore.Query
+	if t.Group {
+		query = eng.client.CollectionGroup(t.Target).Query
+	} else {
+		query = eng.client.Collection(t.Target).Query
+	}
+	if t.Key != "" {
+		query = query.Where(t.Key, "==", t.SourceID)
+	}
+	return query
+}
@@ -0,0 +1,156 @@
+package denorm
+
+import (
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+)
+
+// Propagation declares fields of source documents that are copied (denormalized) into every document of
+// a target collection referencing the source, e.g. `displayName` of `users/{uid}` into `author.displayName`
+// of `novels` whose `author.uid` equals uid.
+type Propagation struct {
+	// Name identifies the propagation, its progress is checkpointed under this step name.
+	Name string
+	// Source is pattern of the source documents, e.g. `users/{uid}`.
+	Source string
+	// Fields maps source fields to target fields they are copied into, e.g. `displayName` to `author.displayName`.
+	Fields map[string]string
+	// Collection is path of the target collection, which can use parameters of Source,
+	// e.g. `novels/{novelId}/chapters`. With Group set, it's the ID of a collection group instead.
+	Collection string
+	Group      bool
+	// Key is the target field holding ID of the source document, e.g. `author.uid`. When empty,
+	// every document in Collection is targeted.
+	Key string
+
+	source *gcp.Pattern
+}
+
+// Task is a propagation triggered by a change of a particular source document.
+type Task struct {
+	*Propagation
+	// SourceID is the ID of the changed source document, matched against Key.
+	SourceID string
+	// Target is path of the target collection, with parameters of Source filled in.
+	Target string
+	// Values holds the new values by target fields. Fields removed from the source are firestore.Delete.
+	Values map[string]interface{}
+}
+
+// Registry holds propagations, run in order of registration.
+type Registry struct {
+	propagations []*Propagation
+}
+
+// NewRegistry returns a Registry without any propagations.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds propagation p. It panics if p is invalid, as propagations are declared when initializing.
+func (r *Registry) Register(p Propagation) {
+	if p.Name == "" || p.Collection == "" || len(p.Fields) == 0 {
+		panic(fmt.Sprintf("denorm: propagation %q needs Name, Collection and Fields", p.Name))
+	}
+	for _, other := range r.propagations {
+		if other.Name == p.Name {
+			panic(fmt.Sprintf("denorm: propagation %q registered twice", p.Name))
+		}
+	}
+	p.source = gcp.MustParsePattern(p.Source)
+	r.propagations = append(r.propagations, &p)
+}
+
+// Tasks returns tasks of propagations whose source document was updated by event e, and whose source
+// fields changed. Deleting the source document doesn't trigger any propagation.
+func (r *Registry) Tasks(e gcp.FirestoreEvent) ([]Task, error) {
+	if e.Value.Name == "" {
+		return nil, nil // deleted
+	}
+	resource, err := gcp.ParseResourceName(e.Value.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []Task
+	for _, p := range r.propagations {
+		params, ok := resource.Match(p.source)
+		if !ok || !p.changed(e) {
+			continue
+		}
+		collection, err := expand(p.Collection, params)
+		if err != nil {
+			return nil, err
+		}
+
+		values := map[string]interface{}{}
+		for src, dst := range p.Fields {
+			v := e.Value.Fields.Get(src)
+			if !v.IsSet() {
+				values[dst] = firestore.Delete
+				continue
+			}
+			values[dst] = v.Interface()
+		}
+		tasks = append(tasks, Task{
+			Propagation: p,
+			SourceID:    resource.ID(),
+			Target:      collection,
+			Values:      values,
+		})
+	}
+	return tasks, nil
+}
+
+// Triggered reports whether event e triggers any of the propagations.
+func (r *Registry) Triggered(e gcp.FirestoreEvent) bool {
+	tasks, _ := r.Tasks(e)
+	return len(tasks) > 0
+}
+
+func (p *Propagation) changed(e gcp.FirestoreEvent) bool {
+	for src := range p.Fields {
+		if e.Changed(src) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand fills `{param}` segments of path with params.
+func expand(path string, params gcp.Params) (string, error) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		value, ok := params[segment[1:len(segment)-1]]
+		if !ok {
+			return "", fmt.Errorf("denorm: no parameter for `%v` in %q", segment, path)
+		}
+		segments[i] = value
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// Update returns the values as nested maps, to be written with firestore.MergeAll.
+func (t *Task) Update() map[string]interface{} {
+	update := map[string]interface{}{}
+	for path, v := range t.Values {
+		names := gcp.SplitPath(path)
+		m := update
+		for _, name := range names[:len(names)-1] {
+			nested, ok := m[name].(map[string]interface{})
+			if !ok {
+				nested = map[string]interface{}{}
+				m[name] = nested
+			}
+			m = nested
+		}
+		m[names[len(names)-1]] = v
+	}
+	return update
+}
@@ -0,0 +1,74 @@
+package denorm
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(Propagation{
+		Name:       "novels",
+		Source:     "users/{uid}",
+		Fields:     map[string]string{"displayName": "author.displayName", "photoURL": "author.photoURL"},
+		Collection: "novels",
+		Key:        "author.uid",
+	})
+	registry.Register(Propagation{
+		Name:       "chapters",
+		Source:     "novels/{novelId}",
+		Fields:     map[string]string{"title": "novel.title"},
+		Collection: "novels/{novelId}/chapters",
+	})
+
+	str := func(s string) gcp.Value { return gcp.Value{Type: gcp.StringType, StringValue: s} }
+	e := gcp.FirestoreEvent{
+		OldValue: gcp.FirestoreValue{
+			Name:   "projects/p/databases/(default)/documents/users/u1",
+			Fields: gcp.Fields{"displayName": str("Old"), "photoURL": str("a.jpg"), "email": str("a@b.c")},
+		},
+		Value: gcp.FirestoreValue{
+			Name:   "projects/p/databases/(default)/documents/users/u1",
+			Fields: gcp.Fields{"displayName": str("New"), "email": str("a@b.c")},
+		},
+		UpdateMask: gcp.FieldPaths{FieldPaths: []string{"displayName", "photoURL"}},
+	}
+
+	tasks, err := registry.Tasks(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Name != "novels" || tasks[0].SourceID != "u1" || tasks[0].Target != "novels" {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+	want := map[string]interface{}{
+		"author": map[string]interface{}{"displayName": "New", "photoURL": firestore.Delete},
+	}
+	if update := tasks[0].Update(); !reflect.DeepEqual(update, want) {
+		t.Errorf("Update = %v, want %v", update, want)
+	}
+
+	// Unrelated fields don't trigger anything
+	e.UpdateMask.FieldPaths = []string{"email"}
+	if registry.Triggered(e) {
+		t.Error("triggered by email")
+	}
+
+	// Parameters of the source fill in the target collection
+	e = gcp.FirestoreEvent{
+		Value: gcp.FirestoreValue{
+			Name:   "projects/p/databases/(default)/documents/novels/n1",
+			Fields: gcp.Fields{"title": str("Title")},
+		},
+	}
+	tasks, err = registry.Tasks(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Target != "novels/n1/chapters" || tasks[0].Key != "" {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+}
@@ -0,0 +1,97 @@
+// Package auth holds types for decoding Firebase Auth events, shared by all auth-triggered functions.
+package auth
+
+import (
+	"strings"
+	"time"
+)
+
+// AuthEvent is the payload of a Firebase Auth event (user.create and user.delete).
+type AuthEvent struct {
+	UID           string                 `json:"uid"`
+	DisplayName   string                 `json:"displayName"`
+	Email         string                 `json:"email"`
+	EmailVerified bool                   `json:"emailVerified"`
+	PhoneNumber   string                 `json:"phoneNumber"`
+	PhotoURL      string                 `json:"photoURL"`
+	Disabled      bool                   `json:"disabled"`
+	ProviderData  []UserInfo             `json:"providerData"`
+	CustomClaims  map[string]interface{} `json:"customClaims"`
+	Metadata      UserMetadata           `json:"metadata"`
+}
+
+// UserInfo holds user's profile at one of the sign-in providers (`password`, `google.com`, ...).
+type UserInfo struct {
+	UID         string `json:"uid"`
+	ProviderID  string `json:"providerId"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email"`
+	PhoneNumber string `json:"phoneNumber"`
+	PhotoURL    string `json:"photoURL"`
+}
+
+// UserMetadata holds creation and last sign-in time of the user. Depending on the
+// event's origin (and CloudEvents), any of the field names for each is used.
+type UserMetadata struct {
+	CreatedAt      time.Time `json:"createdAt"`
+	CreationTime   time.Time `json:"creationTime"`
+	CreateTime     time.Time `json:"createTime"`
+	LastSignedInAt time.Time `json:"lastSignedInAt"`
+	LastSignInTime time.Time `json:"lastSignInTime"`
+}
+
+// Created returns time the user was created at.
+func (m UserMetadata) Created() time.Time {
+	switch {
+	case !m.CreatedAt.IsZero():
+		return m.CreatedAt
+	case !m.CreationTime.IsZero():
+		return m.CreationTime
+	}
+	return m.CreateTime
+}
+
+// LastSignIn returns time the user last signed in at.
+func (m UserMetadata) LastSignIn() time.Time {
+	if m.LastSignedInAt.IsZero() {
+		return m.LastSignInTime
+	}
+	return m.LastSignedInAt
+}
+
+// Provider returns user's profile at the sign-in provider providerID, and whether the user uses it.
+func (e AuthEvent) Provider(providerID string) (UserInfo, bool) {
+	for _, info := range e.ProviderData {
+		if info.ProviderID == providerID {
+			return info, true
+		}
+	}
+	return UserInfo{}, false
+}
+
+// Claim returns custom claim name of the user, and whether it's set.
+func (e AuthEvent) Claim(name string) (interface{}, bool) {
+	val, ok := e.CustomClaims[name]
+	return val, ok
+}
+
+// DefaultDisplayName returns the display name to use for the user: the one set, or one of the
+// sign-in providers, or else derived from user's email. Users without any of those (e.g. anonymous,
+// or signed in by phone) are named by the beginning of their UID, since the name is public.
+func (e AuthEvent) DefaultDisplayName() string {
+	if e.DisplayName != "" {
+		return e.DisplayName
+	}
+	for _, info := range e.ProviderData {
+		if info.DisplayName != "" {
+			return info.DisplayName
+		}
+	}
+	if i := strings.Index(e.Email, "@"); i > 0 {
+		return e.Email[:i]
+	}
+	if len(e.UID) > 8 {
+		return "user-" + e.UID[:8]
+	}
+	return "user-" + e.UID
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const createEvent = `{
+	"uid": "Ko2vGz6jw1R0cDvCwR6Kd3Q2uLk1",
+	"email": "reader@example.com",
+	"emailVerified": false,
+	"disabled": false,
+	"providerData": [{"uid": "reader@example.com", "providerId": "password", "email": "reader@example.com"}],
+	"customClaims": {"admin": true},
+	"metadata": {"createdAt": "2019-12-08T23:53:41Z", "lastSignedInAt": "2019-12-09T10:00:00Z"}
+}`
+
+func TestAuthEvent(t *testing.T) {
+	var e AuthEvent
+	if err := json.Unmarshal([]byte(createEvent), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := e.DefaultDisplayName(); name != "reader" {
+		t.Errorf("DefaultDisplayName = %q", name)
+	}
+	if _, ok := e.Provider("password"); !ok {
+		t.Error("password provider not found")
+	}
+	if admin, _ := e.Claim("admin"); admin != true {
+		t.Errorf("admin claim = %v", admin)
+	}
+	if e.Metadata.Created().IsZero() || !e.Metadata.Created().Before(e.Metadata.LastSignIn()) {
+		t.Errorf("metadata = %+v", e.Metadata)
+	}
+
+	// Anonymous users have neither email nor phone number
+	anonymous := AuthEvent{UID: "Ko2vGz6jw1R0cDvCwR6Kd3Q2uLk1"}
+	if name := anonymous.DefaultDisplayName(); name != "user-Ko2vGz6j" {
+		t.Errorf("DefaultDisplayName = %q", name)
+	}
+
+	// Phone number is private, so it's never used as the name
+	phone := AuthEvent{UID: "Ko2vGz6jw1R0cDvCwR6Kd3Q2uLk1", PhoneNumber: "+15555550100"}
+	if name := phone.DefaultDisplayName(); name != "user-Ko2vGz6j" {
+		t.Errorf("DefaultDisplayName = %q", name)
+	}
+}
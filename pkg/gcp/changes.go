@@ -0,0 +1,131 @@
+package gcp
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var simpleFieldName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z_0-9]*$`)
+
+// SplitPath splits a dot separated field path (e.g. `author.uid`) into field names,
+// unquoting names quoted with backticks (e.g. "`first.name`.initial").
+func SplitPath(path string) []string {
+	var (
+		parts  []string
+		part   strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '\\' && quoted && i+1 < len(path):
+			i++
+			part.WriteByte(path[i])
+		case c == '`':
+			quoted = !quoted
+		case c == '.' && !quoted:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(c)
+		}
+	}
+	return append(parts, part.String())
+}
+
+// JoinPath joins field names into a dot separated field path, quoting names that aren't simple identifiers.
+func JoinPath(names ...string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		if simpleFieldName.MatchString(name) {
+			quoted[i] = name
+		} else {
+			quoted[i] = "`" + strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(name) + "`"
+		}
+	}
+	return strings.Join(quoted, ".")
+}
+
+// Change returns the old and new value of the field at path.
+func (e FirestoreEvent) Change(path string) (oldValue, newValue Value) {
+	return e.OldValue.Fields.Get(path), e.Value.Fields.Get(path)
+}
+
+// Changed reports whether the field at path, or any field nested in it, changed. When the event holds
+// an update mask, only fields covered by it are considered changed.
+func (e FirestoreEvent) Changed(path string) bool {
+	if !e.masked(SplitPath(path)) {
+		return false
+	}
+	oldValue, newValue := e.Change(path)
+	return !oldValue.Equal(newValue)
+}
+
+// ChangedPaths returns sorted paths of all the fields that changed. With an update mask, these are
+// the paths of the mask whose values actually differ. Otherwise (e.g. for create and delete events)
+// old and new values are compared, reporting the innermost fields of nested maps that changed.
+func (e FirestoreEvent) ChangedPaths() []string {
+	var paths []string
+	if len(e.UpdateMask.FieldPaths) > 0 {
+		for _, path := range e.UpdateMask.FieldPaths {
+			if oldValue, newValue := e.Change(path); !oldValue.Equal(newValue) {
+				paths = append(paths, path)
+			}
+		}
+	} else {
+		paths = diffFields(e.OldValue.Fields, e.Value.Fields, nil, paths)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// masked reports whether the update mask covers path, either because it's nested in one of the
+// masked fields or because it contains one of them. Events without update mask cover every path.
+func (e FirestoreEvent) masked(path []string) bool {
+	if len(e.UpdateMask.FieldPaths) == 0 {
+		return true
+	}
+	for _, maskPath := range e.UpdateMask.FieldPaths {
+		mask := SplitPath(maskPath)
+		n := len(mask)
+		if len(path) < n {
+			n = len(path)
+		}
+		covered := true
+		for i := 0; i < n; i++ {
+			if mask[i] != path[i] {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return true
+		}
+	}
+	return false
+}
+
+func diffFields(oldFields, newFields Fields, prefix []string, paths []string) []string {
+	names := map[string]bool{}
+	for name := range oldFields {
+		names[name] = true
+	}
+	for name := range newFields {
+		names[name] = true
+	}
+
+	for name := range names {
+		path := append(append([]string{}, prefix...), name)
+		oldValue, newValue := oldFields[name], newFields[name]
+		if oldValue.Equal(newValue) {
+			continue
+		}
+		if oldValue.Type == MapType && newValue.Type == MapType {
+			paths = diffFields(oldValue.MapValue, newValue.MapValue, path, paths)
+			continue
+		}
+		paths = append(paths, JoinPath(path...))
+	}
+	return paths
+}
@@ -0,0 +1,56 @@
+package gcp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestChangedPaths(t *testing.T) {
+	const update = `{
+		"oldValue": {"fields": {
+			"displayName": {"stringValue": "Old"},
+			"author": {"mapValue": {"fields": {"uid": {"stringValue": "u1"}, "name": {"stringValue": "A"}}}},
+			"first.name": {"stringValue": "x"},
+			"nRatings": {"integerValue": "1"}
+		}},
+		"value": {"fields": {
+			"displayName": {"stringValue": "New"},
+			"author": {"mapValue": {"fields": {"uid": {"stringValue": "u1"}, "name": {"stringValue": "B"}}}},
+			"first.name": {"stringValue": "y"},
+			"nRatings": {"integerValue": "2"}
+		}},
+		"updateMask": {"fieldPaths": ["displayName", "author.name", "` + "`first.name`" + `"]}
+	}`
+	var e FirestoreEvent
+	if err := json.Unmarshal([]byte(update), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"`first.name`", "author.name", "displayName"}
+	if got := e.ChangedPaths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedPaths = %v, want %v", got, want)
+	}
+	for path, changed := range map[string]bool{
+		"displayName":  true,
+		"author":       true,
+		"author.name":  true,
+		"author.uid":   false,
+		"`first.name`": true,
+		"nRatings":     false, // not in update mask
+	} {
+		if e.Changed(path) != changed {
+			t.Errorf("Changed(%v) = %v", path, !changed)
+		}
+	}
+	if oldName, newName := e.Change("author.name"); oldName.StringValue != "A" || newName.StringValue != "B" {
+		t.Errorf("Change(author.name) = %v, %v", oldName, newName)
+	}
+
+	// Without update mask, the values are compared
+	e.UpdateMask.FieldPaths = nil
+	want = []string{"`first.name`", "author.name", "displayName", "nRatings"}
+	if got := e.ChangedPaths(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ChangedPaths without mask = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+// Package cloudevents adapts background functions, written for legacy event payloads and metadata
+// (cloud.google.com/go/functions/metadata), to CloudEvents delivered over HTTP by newer function runtimes.
+package cloudevents
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event is a CloudEvent, as delivered in either binary or structured HTTP mode.
+type Event struct {
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	SpecVersion     string    `json:"specversion"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            []byte    `json:"-"`
+}
+
+// structuredContentType is media type of events in structured mode
+const structuredContentType = "application/cloudevents+json"
+
+// FromRequest reads the CloudEvent from HTTP request r. Events in structured mode are recognized by
+// their content type, otherwise the request is read in binary mode, with attributes in `ce-` headers.
+func FromRequest(r *http.Request) (*Event, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == structuredContentType {
+		return parseStructured(body)
+	}
+
+	e := &Event{
+		ID:              r.Header.Get("ce-id"),
+		Source:          r.Header.Get("ce-source"),
+		Type:            r.Header.Get("ce-type"),
+		SpecVersion:     r.Header.Get("ce-specversion"),
+		Subject:         r.Header.Get("ce-subject"),
+		DataContentType: r.Header.Get("Content-Type"),
+		Data:            body,
+	}
+	if t := r.Header.Get("ce-time"); t != "" {
+		if e.Time, err = time.Parse(time.RFC3339Nano, t); err != nil {
+			return nil, fmt.Errorf("cloudevents: invalid ce-time: %v", err)
+		}
+	}
+	return e, e.validate()
+}
+
+func parseStructured(body []byte) (*Event, error) {
+	var wire struct {
+		Event
+		Data       json.RawMessage `json:"data"`
+		DataBase64 string          `json:"data_base64"`
+	}
+	if err := json.Unmarshal(body, &wire); err != nil {
+		return nil, fmt.Errorf("cloudevents: decoding structured event: %v", err)
+	}
+
+	e := wire.Event
+	switch {
+	case wire.DataBase64 != "":
+		data, err := base64.StdEncoding.DecodeString(wire.DataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("cloudevents: decoding data_base64: %v", err)
+		}
+		e.Data = data
+	case isJSON(e.DataContentType):
+		e.Data = wire.Data
+	case len(wire.Data) > 0:
+		// Non-JSON data is embedded as a string
+		var s string
+		if err := json.Unmarshal(wire.Data, &s); err != nil {
+			return nil, fmt.Errorf("cloudevents: decoding data: %v", err)
+		}
+		e.Data = []byte(s)
+	}
+	return &e, e.validate()
+}
+
+func (e *Event) validate() error {
+	if e.ID == "" || e.Source == "" || e.Type == "" || e.SpecVersion == "" {
+		return errors.New("cloudevents: missing required attribute (id, source, type or specversion)")
+	}
+	return nil
+}
+
+// isJSON reports whether data of contentType is JSON, which is also assumed when it isn't specified.
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,133 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+	pb "google.golang.org/genproto/googleapis/firestore/v1"
+)
+
+// documentEventData is data of Firestore events encoded with protobuf (`google.events.cloud.firestore.v1.DocumentEventData`).
+// Its documents are encoded the same as `google.firestore.v1.Document`.
+type documentEventData struct {
+	Value      *pb.Document     `protobuf:"bytes,1,opt,name=value,proto3"`
+	OldValue   *pb.Document     `protobuf:"bytes,2,opt,name=old_value,json=oldValue,proto3"`
+	UpdateMask *pb.DocumentMask `protobuf:"bytes,3,opt,name=update_mask,json=updateMask,proto3"`
+}
+
+func (m *documentEventData) Reset()         { *m = documentEventData{} }
+func (m *documentEventData) String() string { return proto.CompactTextString(m) }
+func (*documentEventData) ProtoMessage()    {}
+
+// isProtobuf reports whether data of contentType is encoded with protobuf.
+func isProtobuf(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/protobuf" || mediaType == "application/x-protobuf"
+}
+
+// firestoreLegacyData decodes protobuf encoded data of a Firestore event into JSON of the legacy payload.
+func firestoreLegacyData(data []byte) ([]byte, error) {
+	var wire documentEventData
+	if err := proto.Unmarshal(data, &wire); err != nil {
+		return nil, fmt.Errorf("cloudevents: decoding Firestore event: %v", err)
+	}
+
+	var (
+		e   gcp.FirestoreEvent
+		err error
+	)
+	if e.Value, err = documentValue(wire.Value); err != nil {
+		return nil, err
+	}
+	if e.OldValue, err = documentValue(wire.OldValue); err != nil {
+		return nil, err
+	}
+	if wire.UpdateMask != nil {
+		e.UpdateMask.FieldPaths = wire.UpdateMask.FieldPaths
+	}
+	return json.Marshal(e)
+}
+
+// documentValue converts doc into its legacy form, which is empty for missing doc (e.g. old value of created documents).
+func documentValue(doc *pb.Document) (gcp.FirestoreValue, error) {
+	var (
+		fv  gcp.FirestoreValue
+		err error
+	)
+	if doc == nil {
+		return fv, nil
+	}
+	fv.Name = doc.Name
+	if doc.CreateTime != nil {
+		if fv.CreateTime, err = ptypes.Timestamp(doc.CreateTime); err != nil {
+			return fv, err
+		}
+	}
+	if doc.UpdateTime != nil {
+		if fv.UpdateTime, err = ptypes.Timestamp(doc.UpdateTime); err != nil {
+			return fv, err
+		}
+	}
+	fv.Fields, err = fields(doc.Fields)
+	return fv, err
+}
+
+func fields(src map[string]*pb.Value) (gcp.Fields, error) {
+	if len(src) == 0 {
+		return nil, nil
+	}
+	dst := make(gcp.Fields, len(src))
+	for name, v := range src {
+		val, err := value(v)
+		if err != nil {
+			return nil, fmt.Errorf("cloudevents: field %v: %v", name, err)
+		}
+		dst[name] = val
+	}
+	return dst, nil
+}
+
+func value(src *pb.Value) (gcp.Value, error) {
+	var err error
+	switch v := src.GetValueType().(type) {
+	case *pb.Value_NullValue:
+		return gcp.Value{Type: gcp.NullType}, nil
+	case *pb.Value_BooleanValue:
+		return gcp.Value{Type: gcp.BooleanType, BooleanValue: v.BooleanValue}, nil
+	case *pb.Value_IntegerValue:
+		return gcp.Value{Type: gcp.IntegerType, IntegerValue: v.IntegerValue}, nil
+	case *pb.Value_DoubleValue:
+		return gcp.Value{Type: gcp.DoubleType, DoubleValue: v.DoubleValue}, nil
+	case *pb.Value_TimestampValue:
+		dst := gcp.Value{Type: gcp.TimestampType}
+		dst.TimestampValue, err = ptypes.Timestamp(v.TimestampValue)
+		return dst, err
+	case *pb.Value_StringValue:
+		return gcp.Value{Type: gcp.StringType, StringValue: v.StringValue}, nil
+	case *pb.Value_BytesValue:
+		return gcp.Value{Type: gcp.BytesType, BytesValue: v.BytesValue}, nil
+	case *pb.Value_ReferenceValue:
+		return gcp.Value{Type: gcp.ReferenceType, ReferenceValue: v.ReferenceValue}, nil
+	case *pb.Value_GeoPointValue:
+		return gcp.Value{Type: gcp.GeoPointType, GeoPointValue: v.GeoPointValue}, nil
+	case *pb.Value_ArrayValue:
+		dst := gcp.Value{Type: gcp.ArrayType}
+		for _, elem := range v.ArrayValue.GetValues() {
+			val, err := value(elem)
+			if err != nil {
+				return dst, err
+			}
+			dst.ArrayValue = append(dst.ArrayValue, val)
+		}
+		return dst, nil
+	case *pb.Value_MapValue:
+		dst := gcp.Value{Type: gcp.MapType}
+		dst.MapValue, err = fields(v.MapValue.GetFields())
+		return dst, err
+	}
+	return gcp.Value{}, fmt.Errorf("unsupported value type %T", src.GetValueType())
+}
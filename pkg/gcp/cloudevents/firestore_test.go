@@ -0,0 +1,101 @@
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+	pb "google.golang.org/genproto/googleapis/firestore/v1"
+)
+
+func TestFirestoreProtobuf(t *testing.T) {
+	const name = "projects/p/databases/(default)/documents/users/u1"
+	created := time.Date(2019, 12, 8, 23, 53, 41, 0, time.UTC)
+	ts, _ := ptypes.TimestampProto(created)
+	data, err := proto.Marshal(&documentEventData{
+		Value: &pb.Document{
+			Name: name,
+			Fields: map[string]*pb.Value{
+				"displayName": {ValueType: &pb.Value_StringValue{StringValue: "New"}},
+				"nNovels":     {ValueType: &pb.Value_IntegerValue{IntegerValue: 3}},
+				"createdAt":   {ValueType: &pb.Value_TimestampValue{TimestampValue: ts}},
+				"tags": {ValueType: &pb.Value_ArrayValue{ArrayValue: &pb.ArrayValue{Values: []*pb.Value{
+					{ValueType: &pb.Value_StringValue{StringValue: "magic"}},
+				}}}},
+				"author": {ValueType: &pb.Value_MapValue{MapValue: &pb.MapValue{Fields: map[string]*pb.Value{
+					"uid": {ValueType: &pb.Value_StringValue{StringValue: "u1"}},
+				}}}},
+			},
+			CreateTime: ts,
+			UpdateTime: ts,
+		},
+		OldValue: &pb.Document{
+			Name:   name,
+			Fields: map[string]*pb.Value{"displayName": {ValueType: &pb.Value_StringValue{StringValue: "Old"}}},
+		},
+		UpdateMask: &pb.DocumentMask{FieldPaths: []string{"displayName"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got gcp.FirestoreEvent
+	h := MustHandler(func(ctx context.Context, e gcp.FirestoreEvent) error {
+		got = e
+		return nil
+	})
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(data))
+	r.Header.Set("Content-Type", "application/protobuf")
+	r.Header.Set("ce-id", "1")
+	r.Header.Set("ce-specversion", "1.0")
+	r.Header.Set("ce-type", "google.cloud.firestore.document.v1.updated")
+	r.Header.Set("ce-source", "//firestore.googleapis.com/projects/p/databases/(default)")
+	r.Header.Set("ce-subject", "documents/users/u1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %v: %v", w.Code, w.Body)
+	}
+	var user struct {
+		DisplayName string    `firestore:"displayName"`
+		NNovels     int       `firestore:"nNovels"`
+		CreatedAt   time.Time `firestore:"createdAt"`
+		Tags        []string  `firestore:"tags"`
+		Author      struct {
+			UID string `firestore:"uid"`
+		} `firestore:"author"`
+	}
+	if err := got.Value.DataTo(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.DisplayName != "New" || user.NNovels != 3 || !user.CreatedAt.Equal(created) ||
+		len(user.Tags) != 1 || user.Author.UID != "u1" {
+		t.Errorf("value = %+v", user)
+	}
+	if got.Value.Name != name || !got.Value.UpdateTime.Equal(created) {
+		t.Errorf("document = %v, updated at %v", got.Value.Name, got.Value.UpdateTime)
+	}
+	if !got.Changed("displayName") || got.OldValue.Fields["displayName"].StringValue != "Old" {
+		t.Errorf("change = %+v, mask = %v", got.OldValue, got.UpdateMask.FieldPaths)
+	}
+
+	// Malformed protobuf is rejected, rather than retried
+	r = httptest.NewRequest("POST", "/", bytes.NewReader([]byte("\x0a\x05")))
+	r.Header.Set("Content-Type", "application/protobuf")
+	r.Header.Set("ce-id", "2")
+	r.Header.Set("ce-specversion", "1.0")
+	r.Header.Set("ce-type", "google.cloud.firestore.document.v1.updated")
+	r.Header.Set("ce-source", "//firestore.googleapis.com/projects/p/databases/(default)")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,91 @@
+package cloudevents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+var (
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Handler serves CloudEvents by invoking a background function with the equivalent legacy payload
+// and metadata in its context, so the same function runs on both legacy and newer runtimes.
+type Handler struct {
+	fn        reflect.Value
+	eventType reflect.Type
+}
+
+// NewHandler returns Handler invoking background function fn, with signature
+// `func(ctx context.Context, e T) error`, where T is the payload type, e.g. gcse.GCSEvent.
+func NewHandler(fn interface{}) (*Handler, error) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.NumOut() != 1 ||
+		t.In(0) != typeOfContext || t.Out(0) != typeOfError {
+		return nil, fmt.Errorf("cloudevents: expected func(context.Context, T) error, got %v", t)
+	}
+	return &Handler{fn: v, eventType: t.In(1)}, nil
+}
+
+// MustHandler is like NewHandler, but panics if fn has unexpected signature. It simplifies
+// initialization of global variables holding handlers.
+func MustHandler(fn interface{}) *Handler {
+	h, err := NewHandler(fn)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// ServeHTTP decodes the CloudEvent and invokes the function. Malformed events are rejected with
+// status 400 or 415, while errors returned by the function are reported with 500, so they're retried.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e, err := FromRequest(r)
+	if err != nil {
+		log.Printf("cloudevents: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meta, err := e.Metadata()
+	if err != nil {
+		log.Printf("cloudevents: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := e.LegacyData()
+	if err == ErrUnsupportedData {
+		log.Printf("cloudevents: %v: %v", err, e.DataContentType)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		log.Printf("cloudevents: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload := reflect.New(h.eventType)
+	if err := json.Unmarshal(data, payload.Interface()); err != nil {
+		log.Printf("cloudevents: decoding payload: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := metadata.NewContext(r.Context(), meta)
+	out := h.fn.Call([]reflect.Value{reflect.ValueOf(ctx), payload.Elem()})
+	if err, _ := out[0].Interface().(error); err != nil {
+		log.Printf("cloudevents: function failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,94 @@
+package cloudevents
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+type object struct {
+	Name string `json:"name"`
+}
+
+type message struct {
+	Data []byte `json:"data"`
+}
+
+func TestBinaryMode(t *testing.T) {
+	var (
+		got  object
+		meta *metadata.Metadata
+	)
+	h := MustHandler(func(ctx context.Context, e object) error {
+		got = e
+		meta, _ = metadata.FromContext(ctx)
+		return nil
+	})
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name": "novels/abc/cover.orig"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("ce-id", "1234")
+	r.Header.Set("ce-specversion", "1.0")
+	r.Header.Set("ce-type", "google.cloud.storage.object.v1.finalized")
+	r.Header.Set("ce-source", "//storage.googleapis.com/projects/_/buckets/b")
+	r.Header.Set("ce-subject", "objects/novels/abc/cover.orig")
+	r.Header.Set("ce-time", "2019-12-08T23:53:41.123Z")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %v: %v", w.Code, w.Body)
+	}
+	if got.Name != "novels/abc/cover.orig" {
+		t.Errorf("payload = %+v", got)
+	}
+	if meta == nil || meta.EventID != "1234" || meta.EventType != "google.storage.object.finalize" ||
+		meta.Resource.Name != "projects/_/buckets/b/objects/novels/abc/cover.orig" {
+		t.Errorf("metadata = %+v, resource = %+v", meta, meta.Resource)
+	}
+}
+
+func TestStructuredMode(t *testing.T) {
+	var got message
+	h := MustHandler(func(ctx context.Context, m message) error {
+		got = m
+		return nil
+	})
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{
+		"specversion": "1.0",
+		"id": "5678",
+		"type": "google.cloud.pubsub.topic.v1.messagePublished",
+		"source": "//pubsub.googleapis.com/projects/p/topics/cleanup-events",
+		"datacontenttype": "application/json",
+		"data": {"message": {"data": "aGVsbG8=", "messageId": "5678"}, "subscription": "s"}
+	}`))
+	r.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || string(got.Data) != "hello" {
+		t.Errorf("status = %v, message = %q", w.Code, got.Data)
+	}
+
+	// Only Firestore events encoded with protobuf can be mapped onto legacy payload
+	r = httptest.NewRequest("POST", "/", strings.NewReader("\x0a\x00"))
+	r.Header.Set("Content-Type", "application/protobuf")
+	r.Header.Set("ce-id", "1")
+	r.Header.Set("ce-specversion", "1.0")
+	r.Header.Set("ce-type", "google.cloud.storage.object.v1.finalized")
+	r.Header.Set("ce-source", "//storage.googleapis.com/projects/_/buckets/b")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("status = %v, want %v", w.Code, http.StatusUnsupportedMediaType)
+	}
+
+	if _, err := NewHandler(func(e message) error { return nil }); err == nil {
+		t.Error("expected error for unexpected signature")
+	}
+}
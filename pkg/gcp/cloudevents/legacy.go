@@ -0,0 +1,135 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+// ErrUnsupportedData is returned for events with data the legacy payload can't be built from,
+// such as protobuf encoded Storage events.
+var ErrUnsupportedData = errors.New("cloudevents: unsupported data content type")
+
+// service describes how CloudEvents of one service map onto legacy events
+type service struct {
+	name         string // e.g. `firestore.googleapis.com`
+	typePrefix   string // e.g. `google.cloud.firestore.document.v1.`
+	eventTypes   map[string]string
+	resourceType string
+}
+
+var services = []service{
+	{
+		name:       "firestore.googleapis.com",
+		typePrefix: "google.cloud.firestore.document.v1.",
+		eventTypes: map[string]string{
+			"written": "providers/cloud.firestore/eventTypes/document.write",
+			"created": "providers/cloud.firestore/eventTypes/document.create",
+			"updated": "providers/cloud.firestore/eventTypes/document.update",
+			"deleted": "providers/cloud.firestore/eventTypes/document.delete",
+		},
+	},
+	{
+		name:       "storage.googleapis.com",
+		typePrefix: "google.cloud.storage.object.v1.",
+		eventTypes: map[string]string{
+			"finalized":       "google.storage.object.finalize",
+			"deleted":         "google.storage.object.delete",
+			"archived":        "google.storage.object.archive",
+			"metadataUpdated": "google.storage.object.metadataUpdate",
+		},
+		resourceType: "storage#object",
+	},
+	{
+		name:       "firebaseauth.googleapis.com",
+		typePrefix: "google.firebase.auth.user.v1.",
+		eventTypes: map[string]string{
+			"created": "providers/firebase.auth/eventTypes/user.create",
+			"deleted": "providers/firebase.auth/eventTypes/user.delete",
+		},
+	},
+	{
+		name:       "pubsub.googleapis.com",
+		typePrefix: "google.cloud.pubsub.topic.v1.",
+		eventTypes: map[string]string{
+			"messagePublished": "google.pubsub.topic.publish",
+		},
+		resourceType: "type.googleapis.com/google.pubsub.v1.PubsubMessage",
+	},
+}
+
+func (e *Event) service() (*service, string, error) {
+	for i, s := range services {
+		if !strings.HasPrefix(e.Type, s.typePrefix) {
+			continue
+		}
+		eventType, ok := s.eventTypes[strings.TrimPrefix(e.Type, s.typePrefix)]
+		if !ok {
+			break
+		}
+		return &services[i], eventType, nil
+	}
+	return nil, "", fmt.Errorf("cloudevents: unsupported event type %q", e.Type)
+}
+
+// Metadata returns metadata of the equivalent legacy event, as expected by background functions.
+func (e *Event) Metadata() (*metadata.Metadata, error) {
+	s, eventType, err := e.service()
+	if err != nil {
+		return nil, err
+	}
+
+	// Source is `//<service>/<resource>`, e.g. `//storage.googleapis.com/projects/_/buckets/b`
+	name := strings.TrimPrefix(e.Source, "//"+s.name+"/")
+	switch s.name {
+	case "firestore.googleapis.com", "storage.googleapis.com":
+		// Subject holds the rest, e.g. `documents/novels/abc` or `objects/novels/abc/cover.orig`
+		if e.Subject != "" {
+			name += "/" + e.Subject
+		}
+	}
+
+	return &metadata.Metadata{
+		EventID:   e.ID,
+		Timestamp: e.Time,
+		EventType: eventType,
+		Resource: &metadata.Resource{
+			Service: s.name,
+			Name:    name,
+			Type:    s.resourceType,
+		},
+	}, nil
+}
+
+// LegacyData returns data of the equivalent legacy event payload. Data of Storage, Auth and JSON
+// encoded Firestore events is the same, protobuf encoded Firestore events (as delivered by Eventarc)
+// are decoded into JSON, while Pub/Sub messages are unwrapped from their envelope.
+func (e *Event) LegacyData() ([]byte, error) {
+	s, _, err := e.service()
+	if err != nil {
+		return nil, err
+	}
+	if s.name == "firestore.googleapis.com" && isProtobuf(e.DataContentType) {
+		return firestoreLegacyData(e.Data)
+	}
+	if !isJSON(e.DataContentType) {
+		return nil, ErrUnsupportedData
+	}
+	if s.name != "pubsub.googleapis.com" {
+		return e.Data, nil
+	}
+
+	var envelope struct {
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(e.Data, &envelope); err != nil {
+		return nil, fmt.Errorf("cloudevents: decoding Pub/Sub envelope: %v", err)
+	}
+	if envelope.Message == nil {
+		return nil, errors.New("cloudevents: Pub/Sub envelope holds no message")
+	}
+	return envelope.Message, nil
+}
@@ -0,0 +1,19 @@
+package gcp
+
+import "time"
+
+// FirestoreEvent is the payload of a Firestore event.
+type FirestoreEvent struct {
+	OldValue   FirestoreValue `json:"oldValue"`
+	Value      FirestoreValue `json:"value"`
+	UpdateMask FieldPaths     `json:"updateMask"`
+}
+
+// FirestoreValue holds Firestore fields.
+type FirestoreValue struct {
+	CreateTime time.Time `json:"createTime"`
+	// Fields is the data for this value.
+	Fields     Fields    `json:"fields"`
+	Name       string    `json:"name"`
+	UpdateTime time.Time `json:"updateTime"`
+}
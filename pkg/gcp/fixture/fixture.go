@@ -0,0 +1,145 @@
+// Package fixture builds events from plain Go structs for testing functions: the exact wire JSON
+// they are delivered with, along with a context carrying matching metadata.
+package fixture
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+	"github.com/makuc/a-novels-backend/pkg/gcp/gcse"
+)
+
+// Event types of the fixtures
+const (
+	FirestoreCreate = "providers/cloud.firestore/eventTypes/document.create"
+	FirestoreUpdate = "providers/cloud.firestore/eventTypes/document.update"
+	FirestoreDelete = "providers/cloud.firestore/eventTypes/document.delete"
+	StorageFinalize = "google.storage.object.finalize"
+	StorageDelete   = "google.storage.object.delete"
+)
+
+var lastEventID int64
+
+// Event is a fixture of an event, as delivered to a function.
+type Event struct {
+	// JSON is the payload on the wire.
+	JSON []byte
+	// Context carries metadata of the event.
+	Context context.Context
+}
+
+// Decode decodes the payload into v, the same way the function's payload is decoded.
+func (e *Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.JSON, v)
+}
+
+// Metadata returns metadata of the event.
+func (e *Event) Metadata() *metadata.Metadata {
+	meta, _ := metadata.FromContext(e.Context)
+	return meta
+}
+
+func newEvent(payload interface{}, eventType string, resource *metadata.Resource) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	meta := &metadata.Metadata{
+		EventID:   strconv.FormatInt(atomic.AddInt64(&lastEventID, 1), 10),
+		Timestamp: time.Now().UTC(),
+		EventType: eventType,
+		Resource:  resource,
+	}
+	return &Event{
+		JSON:    data,
+		Context: metadata.NewContext(context.Background(), meta),
+	}, nil
+}
+
+// Firestore builds a Firestore event of eventType for document named name (e.g.
+// `projects/p/databases/(default)/documents/users/u1`), changed from oldData into newData. Either
+// of them is nil for create and delete events. Update events get the update mask of changed fields.
+func Firestore(eventType, name string, oldData, newData interface{}) (*Event, error) {
+	var (
+		e   gcp.FirestoreEvent
+		err error
+		now = time.Now().UTC()
+	)
+	if oldData != nil {
+		if e.OldValue.Fields, err = gcp.Marshal(oldData); err != nil {
+			return nil, err
+		}
+		e.OldValue.Name = name
+		e.OldValue.CreateTime = now.Add(-time.Hour)
+		e.OldValue.UpdateTime = now.Add(-time.Hour)
+	}
+	if newData != nil {
+		if e.Value.Fields, err = gcp.Marshal(newData); err != nil {
+			return nil, err
+		}
+		e.Value.Name = name
+		e.Value.CreateTime = now.Add(-time.Hour)
+		e.Value.UpdateTime = now
+		if oldData == nil {
+			e.Value.CreateTime = now
+		}
+	}
+	if oldData != nil && newData != nil {
+		e.UpdateMask.FieldPaths = e.ChangedPaths()
+	}
+
+	return newEvent(e, eventType, &metadata.Resource{
+		Service: "firestore.googleapis.com",
+		Name:    name,
+	})
+}
+
+// Object builds payload of a GCS event for object name in bucket holding data,
+// with its size and checksums.
+func Object(bucket, name, contentType string, data []byte) gcse.GCSEvent {
+	now := time.Now().UTC()
+	generation := strconv.FormatInt(now.UnixNano()/1000, 10)
+	md5sum := md5.Sum(data)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+
+	return gcse.GCSEvent{
+		Kind:           "storage#object",
+		ID:             fmt.Sprintf("%v/%v/%v", bucket, name, generation),
+		SelfLink:       fmt.Sprintf("https://www.googleapis.com/storage/v1/b/%v/o/%v", bucket, name),
+		Name:           name,
+		Bucket:         bucket,
+		Generation:     generation,
+		Metageneration: "1",
+		ContentType:    contentType,
+		TimeCreated:    now,
+		Updated:        now,
+		StorageClass:   "STANDARD",
+		Size:           strconv.Itoa(len(data)),
+		MD5Hash:        base64.StdEncoding.EncodeToString(md5sum[:]),
+		CRC32C:         base64.StdEncoding.EncodeToString(crc),
+		ResourceState:  "exists",
+	}
+}
+
+// Storage builds a GCS event of eventType for object obj (see Object).
+func Storage(eventType string, obj gcse.GCSEvent) (*Event, error) {
+	if eventType == StorageDelete {
+		obj.ResourceState = "not_exists"
+	}
+	return newEvent(obj, eventType, &metadata.Resource{
+		Service: "storage.googleapis.com",
+		Name:    fmt.Sprintf("projects/_/buckets/%v/objects/%v", obj.Bucket, obj.Name),
+		Type:    "storage#object",
+	})
+}
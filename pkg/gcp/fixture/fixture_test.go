@@ -0,0 +1,128 @@
+package fixture
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+	"github.com/makuc/a-novels-backend/pkg/gcp/gcse"
+)
+
+// zeroTime is how encoding/json writes a zero time.Time
+const zeroTime = "0001-01-01T00:00:00Z"
+
+type author struct {
+	UID         string `firestore:"uid"`
+	DisplayName string `firestore:"displayName"`
+}
+
+type novel struct {
+	Title     string    `firestore:"title"`
+	Author    author    `firestore:"author"`
+	Tags      []string  `firestore:"tags"`
+	Rating    float64   `firestore:"rating"`
+	CoverURL  string    `firestore:"coverURL,omitempty"`
+	CreatedAt time.Time `firestore:"createdAt"`
+}
+
+func TestFirestoreRoundtrip(t *testing.T) {
+	const name = "projects/p/databases/(default)/documents/novels/abc"
+	oldNovel := novel{
+		Title:     "Novel",
+		Author:    author{UID: "u1", DisplayName: "Old"},
+		Tags:      []string{"magic"},
+		Rating:    4.5,
+		CreatedAt: time.Date(2019, 12, 8, 23, 53, 41, 0, time.UTC),
+	}
+	newNovel := oldNovel
+	newNovel.Author.DisplayName = "New"
+
+	fx, err := Firestore(FirestoreUpdate, name, oldNovel, newNovel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e gcp.FirestoreEvent
+	if err := fx.Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded novel
+	if err := e.Value.DataTo(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, newNovel) {
+		t.Errorf("roundtrip:\n got %+v\nwant %+v", decoded, newNovel)
+	}
+	if paths := e.UpdateMask.FieldPaths; len(paths) != 1 || paths[0] != "author.displayName" {
+		t.Errorf("update mask = %v", paths)
+	}
+	if _, ok := e.Value.Fields["coverURL"]; ok {
+		t.Error("omitempty field was encoded")
+	}
+
+	meta := fx.Metadata()
+	if meta.EventID == "" || meta.EventType != FirestoreUpdate || meta.Resource.Name != name {
+		t.Errorf("metadata = %+v", meta)
+	}
+
+	// Create events have no old value
+	fx, err = Firestore(FirestoreCreate, name, nil, newNovel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = gcp.FirestoreEvent{}
+	if err := fx.Decode(&e); err != nil || e.OldValue.Fields != nil || len(e.UpdateMask.FieldPaths) != 0 {
+		t.Errorf("create event = %+v, %v", e, err)
+	}
+	if bytes.Contains(fx.JSON, []byte(zeroTime)) {
+		t.Errorf("create event has zero times: %s", fx.JSON)
+	}
+
+	// Text that looks like a zero time is data too
+	fx, err = Firestore(FirestoreCreate, name, nil, novel{Title: zeroTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = gcp.FirestoreEvent{}
+	if err := fx.Decode(&e); err != nil || e.Value.Fields["title"].StringValue != zeroTime {
+		t.Errorf("title = %+v, %v", e.Value.Fields["title"], err)
+	}
+
+	// Zero times of fields are data, unlike unset timestamps of the event
+	fx, err = Firestore(FirestoreCreate, name, nil, novel{Title: "Untimed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = gcp.FirestoreEvent{}
+	if err := fx.Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if created, ok := e.Value.Fields["createdAt"].Time(); !ok || !created.IsZero() {
+		t.Errorf("createdAt = %v, %v", created, ok)
+	}
+}
+
+func TestStorageRoundtrip(t *testing.T) {
+	fx, err := Storage(StorageFinalize, Object("b", "novels/abc/cover.orig", "image/jpeg", []byte("hello world")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e gcse.GCSEvent
+	if err := fx.Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := e.GetSize(); size != 11 {
+		t.Errorf("size = %v", size)
+	}
+	if sum, err := e.GetCRC32C(); err != nil || sum != 0xc99465aa {
+		t.Errorf("crc32c = %x, %v", sum, err)
+	}
+	if fx.Metadata().Resource.Name != "projects/_/buckets/b/objects/novels/abc/cover.orig" {
+		t.Errorf("resource = %+v", fx.Metadata().Resource)
+	}
+	if bytes.Contains(fx.JSON, []byte(zeroTime)) {
+		t.Errorf("event has zero times: %s", fx.JSON)
+	}
+}
@@ -1,38 +1,132 @@
 package gcse
 
-import "time"
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // GCSEvent is the payload of a GCS event.
 type GCSEvent struct {
-	Kind                    string                 `json:"kind"`
-	ID                      string                 `json:"id"`
-	SelfLink                string                 `json:"selfLink"`
-	Name                    string                 `json:"name"`
-	Bucket                  string                 `json:"bucket"`
-	Generation              string                 `json:"generation"`
-	Metageneration          string                 `json:"metageneration"`
-	ContentType             string                 `json:"contentType"`
-	TimeCreated             time.Time              `json:"timeCreated"`
-	Updated                 time.Time              `json:"updated"`
-	TemporaryHold           bool                   `json:"temporaryHold"`
-	EventBasedHold          bool                   `json:"eventBasedHold"`
-	RetentionExpirationTime time.Time              `json:"retentionExpirationTime"`
-	StorageClass            string                 `json:"storageClass"`
-	TimeStorageClassUpdated time.Time              `json:"timeStorageClassUpdated"`
-	Size                    string                 `json:"size"`
-	MD5Hash                 string                 `json:"md5Hash"`
-	MediaLink               string                 `json:"mediaLink"`
-	ContentEncoding         string                 `json:"contentEncoding"`
-	ContentDisposition      string                 `json:"contentDisposition"`
-	CacheControl            string                 `json:"cacheControl"`
-	Metadata                map[string]interface{} `json:"metadata"`
-	CRC32C                  string                 `json:"crc32c"`
-	ComponentCount          int                    `json:"componentCount"`
-	Etag                    string                 `json:"etag"`
+	Kind                    string            `json:"kind"`
+	ID                      string            `json:"id"`
+	SelfLink                string            `json:"selfLink"`
+	Name                    string            `json:"name"`
+	Bucket                  string            `json:"bucket"`
+	Generation              string            `json:"generation"`
+	Metageneration          string            `json:"metageneration"`
+	ContentType             string            `json:"contentType"`
+	TimeCreated             time.Time         `json:"timeCreated"`
+	Updated                 time.Time         `json:"updated"`
+	TemporaryHold           bool              `json:"temporaryHold"`
+	EventBasedHold          bool              `json:"eventBasedHold"`
+	RetentionExpirationTime time.Time         `json:"retentionExpirationTime"`
+	StorageClass            string            `json:"storageClass"`
+	TimeStorageClassUpdated time.Time         `json:"timeStorageClassUpdated"`
+	Size                    string            `json:"size"`
+	MD5Hash                 string            `json:"md5Hash"`
+	MediaLink               string            `json:"mediaLink"`
+	ContentEncoding         string            `json:"contentEncoding"`
+	ContentDisposition      string            `json:"contentDisposition"`
+	CacheControl            string            `json:"cacheControl"`
+	Metadata                map[string]string `json:"metadata"` // custom metadata
+	CRC32C                  string            `json:"crc32c"`
+	ComponentCount          int               `json:"componentCount"`
+	Etag                    string            `json:"etag"`
 	CustomerEncryption      struct {
 		EncryptionAlgorithm string `json:"encryptionAlgorithm"`
 		KeySha256           string `json:"keySha256"`
 	}
 	KMSKeyName    string `json:"kmsKeyName"`
 	ResourceState string `json:"resourceState"`
+
+	// OverwrittenByGeneration is the generation of the object that replaced this one,
+	// set when the event was caused by overwriting the object.
+	OverwrittenByGeneration string `json:"overwrittenByGeneration"`
+	// OverwroteGeneration is the generation of the object this one replaced.
+	OverwroteGeneration string `json:"overwroteGeneration"`
+}
+
+// MarshalJSON encodes the event as delivered, omitting unset times rather than encoding them as zero times.
+func (e GCSEvent) MarshalJSON() ([]byte, error) {
+	type event GCSEvent // without this method, so it isn't called recursively
+	return json.Marshal(struct {
+		event
+		TimeCreated             *time.Time `json:"timeCreated,omitempty"`
+		Updated                 *time.Time `json:"updated,omitempty"`
+		RetentionExpirationTime *time.Time `json:"retentionExpirationTime,omitempty"`
+		TimeStorageClassUpdated *time.Time `json:"timeStorageClassUpdated,omitempty"`
+	}{
+		event:                   event(e),
+		TimeCreated:             timeOrNil(e.TimeCreated),
+		Updated:                 timeOrNil(e.Updated),
+		RetentionExpirationTime: timeOrNil(e.RetentionExpirationTime),
+		TimeStorageClassUpdated: timeOrNil(e.TimeStorageClassUpdated),
+	})
+}
+
+// timeOrNil returns nil for zero t, so it's omitted from JSON.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// GetSize returns size of the object in bytes.
+func (e GCSEvent) GetSize() (int64, error) {
+	return parseInt64("size", e.Size)
+}
+
+// GetGeneration returns generation of the object.
+func (e GCSEvent) GetGeneration() (int64, error) {
+	return parseInt64("generation", e.Generation)
+}
+
+// GetMetageneration returns metageneration of the object.
+func (e GCSEvent) GetMetageneration() (int64, error) {
+	return parseInt64("metageneration", e.Metageneration)
+}
+
+// GetMD5 returns the decoded MD5 hash of the object data, or nil if it has none (composite objects).
+func (e GCSEvent) GetMD5() ([]byte, error) {
+	if e.MD5Hash == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(e.MD5Hash)
+}
+
+// GetCRC32C returns the decoded CRC32C checksum (Castagnoli) of the object data.
+func (e GCSEvent) GetCRC32C() (uint32, error) {
+	b, err := base64.StdEncoding.DecodeString(e.CRC32C)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) != 4 {
+		return 0, fmt.Errorf("gcse: invalid crc32c %q", e.CRC32C)
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// GetMetadata returns value of custom metadata key, and whether it's set.
+func (e GCSEvent) GetMetadata(key string) (string, bool) {
+	val, ok := e.Metadata[key]
+	return val, ok
+}
+
+// IsOverwrite reports whether the object was deleted (or archived) because it was overwritten
+// with a new generation, rather than deleted on its own.
+func (e GCSEvent) IsOverwrite() bool {
+	return e.OverwrittenByGeneration != ""
+}
+
+func parseInt64(field, val string) (int64, error) {
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("gcse: invalid %v %q", field, val)
+	}
+	return n, nil
 }
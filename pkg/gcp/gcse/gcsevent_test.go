@@ -0,0 +1,80 @@
+package gcse
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+const coverEvent = `{
+	"name": "novels/abc/cover.orig",
+	"bucket": "testing-192515.appspot.com",
+	"generation": "1575849221423958",
+	"metageneration": "1",
+	"size": "11",
+	"md5Hash": "XrY7u+Ae7tCTyyK7j1rNww==",
+	"crc32c": "yZRlqg==",
+	"metadata": {"firebaseStorageDownloadTokens": "token"},
+	"overwrittenByGeneration": "1575849221423959"
+}`
+
+func TestGCSEvent(t *testing.T) {
+	var e GCSEvent
+	if err := json.Unmarshal([]byte(coverEvent), &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if size, err := e.GetSize(); err != nil || size != 11 {
+		t.Errorf("GetSize = %v, %v", size, err)
+	}
+	if gen, err := e.GetGeneration(); err != nil || gen != 1575849221423958 {
+		t.Errorf("GetGeneration = %v, %v", gen, err)
+	}
+	if md5, err := e.GetMD5(); err != nil || len(md5) != 16 {
+		t.Errorf("GetMD5 = %x, %v", md5, err)
+	}
+	if sum, err := e.GetCRC32C(); err != nil || sum != crc32.Checksum([]byte("hello world"), crc32.MakeTable(crc32.Castagnoli)) {
+		t.Errorf("GetCRC32C = %x, %v", sum, err)
+	}
+	if token, ok := e.GetMetadata("firebaseStorageDownloadTokens"); !ok || token != "token" {
+		t.Errorf("GetMetadata = %v, %v", token, ok)
+	}
+	if !e.IsOverwrite() {
+		t.Error("overwrite not detected")
+	}
+}
+
+func TestGCSEventMarshal(t *testing.T) {
+	e := GCSEvent{
+		Name:     "novels/abc/cover.orig",
+		Metadata: map[string]string{"note": "0001-01-01T00:00:00Z"},
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire map[string]interface{}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"timeCreated", "updated", "retentionExpirationTime", "timeStorageClassUpdated"} {
+		if _, ok := wire[field]; ok {
+			t.Errorf("unset %v encoded: %s", field, data)
+		}
+	}
+
+	var roundtrip GCSEvent
+	if err := json.Unmarshal(data, &roundtrip); err != nil {
+		t.Fatal(err)
+	}
+	if roundtrip.Name != e.Name || roundtrip.Metadata["note"] != e.Metadata["note"] {
+		t.Errorf("roundtrip = %+v", roundtrip)
+	}
+
+	e.TimeCreated = time.Date(2019, 12, 8, 23, 53, 41, 0, time.UTC)
+	data, _ = json.Marshal(e)
+	if err := json.Unmarshal(data, &roundtrip); err != nil || !roundtrip.TimeCreated.Equal(e.TimeCreated) {
+		t.Errorf("timeCreated = %v, %v", roundtrip.TimeCreated, err)
+	}
+}
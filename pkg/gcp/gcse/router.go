@@ -0,0 +1,55 @@
+package gcse
+
+import (
+	"context"
+
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+)
+
+// HandlerFunc processes a GCS event for an object, with parameters bound from its name.
+type HandlerFunc func(ctx context.Context, e GCSEvent, params gcp.Params) error
+
+type route struct {
+	pattern *gcp.Pattern
+	handler HandlerFunc
+}
+
+// Router dispatches GCS events to handlers registered for patterns matching object names,
+// such as `novels/{novelId}/cover.orig`. Patterns are tried in order of registration.
+type Router struct {
+	routes []route
+}
+
+// NewRouter returns a Router without any handlers.
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers handler h for objects matching pattern. It panics if pattern is invalid.
+func (r *Router) Handle(pattern string, h HandlerFunc) {
+	r.routes = append(r.routes, route{
+		pattern: gcp.MustParsePattern(pattern),
+		handler: h,
+	})
+}
+
+// Match returns the handler for object named name, along with the bound parameters.
+// It reports false if no pattern matches.
+func (r *Router) Match(name string) (HandlerFunc, gcp.Params, bool) {
+	for _, rt := range r.routes {
+		if params, ok := rt.pattern.Match(name); ok {
+			return rt.handler, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// Dispatch invokes the handler matching the object of event e. Events for objects
+// without handlers are ignored.
+func (r *Router) Dispatch(ctx context.Context, e GCSEvent) error {
+	h, params, ok := r.Match(e.Name)
+	if !ok {
+		return nil // Execution not targeted at any of the handlers
+	}
+	return h(ctx, e, params)
+}
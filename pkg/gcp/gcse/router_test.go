@@ -0,0 +1,24 @@
+package gcse
+
+import (
+	"context"
+	"testing"
+
+	"github.com/makuc/a-novels-backend/pkg/gcp"
+)
+
+func TestRouter(t *testing.T) {
+	var novelID string
+	r := NewRouter()
+	r.Handle("novels/{novelId}/cover.orig", func(ctx context.Context, e GCSEvent, params gcp.Params) error {
+		novelID = params["novelId"]
+		return nil
+	})
+
+	if err := r.Dispatch(context.Background(), GCSEvent{Name: "novels/abc/cover.orig"}); err != nil || novelID != "abc" {
+		t.Errorf("Dispatch = %v, novelId = %q", err, novelID)
+	}
+	if _, _, ok := r.Match("users/u1/avatar.orig"); ok {
+		t.Error("matched object without handler")
+	}
+}
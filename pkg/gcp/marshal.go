@@ -0,0 +1,260 @@
+package gcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// MarshalJSON encodes the value as in Firestore Events, such as `{"integerValue": "42"}`.
+func (v Value) MarshalJSON() ([]byte, error) {
+	var wire interface{}
+	switch v.Type {
+	case UnsetType:
+		return nil, errors.New("gcp: cannot encode unset value")
+	case NullType:
+		wire = nil
+	case BooleanType:
+		wire = v.BooleanValue
+	case IntegerType:
+		wire = strconv.FormatInt(v.IntegerValue, 10)
+	case DoubleType:
+		switch {
+		case math.IsNaN(v.DoubleValue):
+			wire = "NaN"
+		case math.IsInf(v.DoubleValue, 1):
+			wire = "Infinity"
+		case math.IsInf(v.DoubleValue, -1):
+			wire = "-Infinity"
+		default:
+			wire = v.DoubleValue
+		}
+	case TimestampType:
+		wire = v.TimestampValue.UTC().Format(time.RFC3339Nano)
+	case StringType:
+		wire = v.StringValue
+	case BytesType:
+		wire = base64.StdEncoding.EncodeToString(v.BytesValue)
+	case ReferenceType:
+		wire = v.ReferenceValue
+	case GeoPointType:
+		wire = map[string]float64{
+			"latitude":  v.GeoPointValue.GetLatitude(),
+			"longitude": v.GeoPointValue.GetLongitude(),
+		}
+	case ArrayType:
+		array := map[string]interface{}{}
+		if len(v.ArrayValue) > 0 {
+			array["values"] = v.ArrayValue
+		}
+		wire = array
+	case MapType:
+		m := map[string]interface{}{}
+		if len(v.MapValue) > 0 {
+			m["fields"] = v.MapValue
+		}
+		wire = m
+	}
+	return json.Marshal(map[string]interface{}{
+		v.Type.String() + "Value": wire,
+	})
+}
+
+// MarshalJSON encodes the value as in Firestore Events, omitting empty fields, as in `oldValue`
+// of create events.
+func (fv FirestoreValue) MarshalJSON() ([]byte, error) {
+	wire := map[string]interface{}{}
+	if !fv.CreateTime.IsZero() {
+		wire["createTime"] = fv.CreateTime
+	}
+	if len(fv.Fields) > 0 {
+		wire["fields"] = fv.Fields
+	}
+	if fv.Name != "" {
+		wire["name"] = fv.Name
+	}
+	if !fv.UpdateTime.IsZero() {
+		wire["updateTime"] = fv.UpdateTime
+	}
+	return json.Marshal(wire)
+}
+
+// Marshal encodes v, a struct or a map with string keys, into fields of a Firestore Event. It's the
+// inverse of Unmarshal, naming struct fields by the `firestore` tags the Firestore client uses.
+func Marshal(v interface{}) (Fields, error) {
+	value, err := encodeValue(reflect.ValueOf(v), "")
+	if err != nil {
+		return nil, err
+	}
+	if value.Type != MapType {
+		return nil, fmt.Errorf("gcp: cannot marshal %T into fields", v)
+	}
+	return value.MapValue, nil
+}
+
+// ValueOf encodes plain Go value v, as accepted by the Firestore client, into a Value.
+func ValueOf(v interface{}) (Value, error) {
+	return encodeValue(reflect.ValueOf(v), "")
+}
+
+func encodeValue(src reflect.Value, path string) (Value, error) {
+	if !src.IsValid() {
+		return Value{Type: NullType}, nil
+	}
+	switch src.Type() {
+	case typeOfValue:
+		return src.Interface().(Value), nil
+	case typeOfTime:
+		return Value{Type: TimestampType, TimestampValue: src.Interface().(time.Time)}, nil
+	case typeOfLatLng:
+		if src.IsNil() {
+			return Value{Type: NullType}, nil
+		}
+		return Value{Type: GeoPointType, GeoPointValue: src.Interface().(*latlng.LatLng)}, nil
+	case typeOfBytes:
+		if src.IsNil() {
+			return Value{Type: NullType}, nil
+		}
+		return Value{Type: BytesType, BytesValue: src.Bytes()}, nil
+	}
+
+	switch src.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if src.IsNil() {
+			return Value{Type: NullType}, nil
+		}
+		return encodeValue(src.Elem(), path)
+	case reflect.Bool:
+		return Value{Type: BooleanType, BooleanValue: src.Bool()}, nil
+	case reflect.String:
+		return Value{Type: StringType, StringValue: src.String()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Value{Type: IntegerType, IntegerValue: src.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if src.Uint() > math.MaxInt64 {
+			return Value{}, fmt.Errorf("gcp: %v overflows int64 at `%v`", src.Uint(), path)
+		}
+		return Value{Type: IntegerType, IntegerValue: int64(src.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return Value{Type: DoubleType, DoubleValue: src.Float()}, nil
+	case reflect.Slice, reflect.Array:
+		if src.Kind() == reflect.Slice && src.IsNil() {
+			return Value{Type: NullType}, nil
+		}
+		array := make([]Value, src.Len())
+		for i := range array {
+			elem, err := encodeValue(src.Index(i), fmt.Sprintf("%v[%v]", path, i))
+			if err != nil {
+				return Value{}, err
+			}
+			array[i] = elem
+		}
+		return Value{Type: ArrayType, ArrayValue: array}, nil
+	case reflect.Map:
+		if src.Type().Key().Kind() != reflect.String {
+			return Value{}, fmt.Errorf("gcp: cannot encode %v at `%v`", src.Type(), path)
+		}
+		if src.IsNil() {
+			return Value{Type: NullType}, nil
+		}
+		fields := Fields{}
+		for _, key := range src.MapKeys() {
+			name := key.String()
+			elem, err := encodeValue(src.MapIndex(key), joinPath(path, name))
+			if err != nil {
+				return Value{}, err
+			}
+			fields[name] = elem
+		}
+		return Value{Type: MapType, MapValue: fields}, nil
+	case reflect.Struct:
+		fields := Fields{}
+		if err := encodeStruct(src, fields, path); err != nil {
+			return Value{}, err
+		}
+		return Value{Type: MapType, MapValue: fields}, nil
+	}
+	return Value{}, fmt.Errorf("gcp: cannot encode %v at `%v`", src.Type(), path)
+}
+
+// encodeStruct sets fields from the struct src, honoring the same `firestore` tags as decodeStruct,
+// as well as `omitempty`.
+func encodeStruct(src reflect.Value, fields Fields, path string) error {
+	t := src.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue // unexported
+		}
+
+		tag := sf.Tag.Get("firestore")
+		if tag == "-" {
+			continue
+		}
+		options := strings.Split(tag, ",")
+		name := options[0]
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			if err := encodeStruct(src.Field(i), fields, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		fv := src.Field(i)
+		if hasOption(options[1:], "omitempty") && isEmptyValue(fv) {
+			continue
+		}
+		v, err := encodeValue(fv, joinPath(path, name))
+		if err != nil {
+			return err
+		}
+		fields[name] = v
+	}
+	return nil
+}
+
+func hasOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == typeOfTime {
+			return v.Interface().(time.Time).IsZero()
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package gcp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValueMarshal(t *testing.T) {
+	var e FirestoreEvent
+	if err := json.Unmarshal([]byte(novelEvent), &e); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roundtrip FirestoreEvent
+	if err := json.Unmarshal(data, &roundtrip); err != nil {
+		t.Fatal(err)
+	}
+	for name, v := range e.Value.Fields {
+		if !v.Equal(roundtrip.Value.Fields[name]) {
+			t.Errorf("roundtrip of %v = %+v, want %+v", name, roundtrip.Value.Fields[name], v)
+		}
+	}
+	if roundtrip.OldValue.Fields != nil {
+		t.Errorf("empty oldValue = %+v", roundtrip.OldValue)
+	}
+}
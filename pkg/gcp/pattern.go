@@ -0,0 +1,89 @@
+package gcp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Params holds parameters bound by matching a Pattern, by their names.
+type Params map[string]string
+
+// Pattern matches slash separated paths (Firestore document paths or GCS object names) against
+// segments that are either literal or wildcards, e.g. `novels/{novelId}/reviews/{reviewId}`.
+// The last segment can also be a `{name=**}` wildcard, matching all the remaining segments.
+type Pattern struct {
+	raw      string
+	segments []string
+	params   []string // parameter name for every segment, empty for literals
+	rest     string   // name of trailing `{name=**}` parameter
+}
+
+// ParsePattern parses path pattern, as used in trigger resources.
+func ParsePattern(pattern string) (*Pattern, error) {
+	p := &Pattern{raw: pattern}
+	segments := strings.Split(strings.Trim(pattern, "/"), "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			if strings.ContainsAny(segment, "{}") {
+				return nil, fmt.Errorf("gcp: wildcard must span the whole segment in %q", pattern)
+			}
+			p.segments = append(p.segments, segment)
+			p.params = append(p.params, "")
+			continue
+		}
+
+		name := segment[1 : len(segment)-1]
+		if strings.HasSuffix(name, "=**") {
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("gcp: `%v` must be the last segment in %q", segment, pattern)
+			}
+			p.rest = strings.TrimSuffix(name, "=**")
+			continue
+		}
+		if name == "" {
+			return nil, fmt.Errorf("gcp: unnamed wildcard in %q", pattern)
+		}
+		p.segments = append(p.segments, "")
+		p.params = append(p.params, name)
+	}
+	return p, nil
+}
+
+// MustParsePattern is like ParsePattern, but panics if pattern is invalid. It simplifies
+// initialization of global variables holding patterns.
+func MustParsePattern(pattern string) *Pattern {
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Match reports whether path matches the pattern, returning the bound parameters.
+func (p *Pattern) Match(path string) (Params, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < len(p.segments) || (p.rest == "" && len(segments) != len(p.segments)) {
+		return nil, false
+	}
+
+	params := Params{}
+	for i, name := range p.params {
+		switch {
+		case name == "" && segments[i] != p.segments[i]:
+			return nil, false
+		case name != "":
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[name] = segments[i]
+		}
+	}
+	if p.rest != "" {
+		params[p.rest] = strings.Join(segments[len(p.segments):], "/")
+	}
+	return params, true
+}
+
+func (p *Pattern) String() string {
+	return p.raw
+}
@@ -0,0 +1,82 @@
+// Package pubsub holds types for decoding Pub/Sub events, for functions triggered by topics.
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
+)
+
+// Message is the payload of a Pub/Sub event.
+type Message struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	MessageID   string            `json:"messageId"`
+	PublishTime time.Time         `json:"publishTime"`
+}
+
+// Decode decodes JSON data of the message into v. Messages without data leave v as is,
+// so scheduled jobs may publish an empty body to use the defaults.
+func (m Message) Decode(v interface{}) error {
+	if len(m.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(m.Data, v)
+}
+
+// Attribute returns value of attribute key, and whether it's set.
+func (m Message) Attribute(key string) (string, bool) {
+	val, ok := m.Attributes[key]
+	return val, ok
+}
+
+// Complete fills MessageID and PublishTime from event metadata in ctx, since legacy
+// background events deliver them there, instead of in the payload.
+func (m *Message) Complete(ctx context.Context) {
+	meta, err := metadata.FromContext(ctx)
+	if err != nil {
+		return
+	}
+	if m.MessageID == "" {
+		m.MessageID = meta.EventID
+	}
+	if m.PublishTime.IsZero() {
+		m.PublishTime = meta.Timestamp
+	}
+}
+
+// Context returns ctx carrying event metadata keyed by the message ID, also for messages
+// delivered without any (e.g. by push subscriptions), so pkg/idempotent can track them.
+func (m Message) Context(ctx context.Context) (context.Context, error) {
+	meta, err := metadata.FromContext(ctx)
+	if err != nil {
+		meta = &metadata.Metadata{
+			Timestamp: m.PublishTime,
+			EventType: "google.pubsub.topic.publish",
+		}
+	}
+	if m.MessageID == "" {
+		if meta.EventID == "" {
+			return nil, errors.New("pubsub: message has no ID")
+		}
+		return ctx, nil
+	}
+
+	keyed := *meta
+	keyed.EventID = m.MessageID
+	return metadata.NewContext(ctx, &keyed), nil
+}
+
+// Wrap executes h indempotently for message m, keyed by its message ID (see idempotent.Wrap).
+func Wrap(ctx context.Context, store idempotent.LeaseStore, m Message, h idempotent.Handler) error {
+	m.Complete(ctx)
+	ctx, err := m.Context(ctx)
+	if err != nil {
+		return err
+	}
+	return idempotent.Wrap(ctx, store, m, h)
+}
@@ -0,0 +1,55 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/functions/metadata"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
+)
+
+func TestMessage(t *testing.T) {
+	var m Message
+	if err := json.Unmarshal([]byte(`{"data": "eyJjb2xsZWN0aW9ucyI6WyJ1c2VyLWV2ZW50cyJdfQ==", "attributes": {"origin": "scheduler"}}`), &m); err != nil {
+		t.Fatal(err)
+	}
+	var req struct {
+		Collections []string `json:"collections"`
+	}
+	if err := m.Decode(&req); err != nil || len(req.Collections) != 1 || req.Collections[0] != "user-events" {
+		t.Errorf("Decode = %+v, %v", req, err)
+	}
+	if origin, _ := m.Attribute("origin"); origin != "scheduler" {
+		t.Errorf("origin = %q", origin)
+	}
+
+	// Legacy events deliver message ID in metadata
+	published := time.Date(2019, 12, 8, 3, 0, 0, 0, time.UTC)
+	ctx := metadata.NewContext(context.Background(), &metadata.Metadata{EventID: "42", Timestamp: published})
+	m.Complete(ctx)
+	if m.MessageID != "42" || !m.PublishTime.Equal(published) {
+		t.Errorf("Complete = %+v", m)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	store := idempotent.NewMemoryStore()
+	m := Message{MessageID: "42"}
+
+	calls := 0
+	for i := 0; i < 2; i++ {
+		// Pushed messages come without event metadata
+		err := Wrap(context.Background(), store, m, func(ctx context.Context, lease *idempotent.Lease) error {
+			calls++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler called %v times for the same message, want once", calls)
+	}
+}
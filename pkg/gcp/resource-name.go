@@ -0,0 +1,115 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+// ResourceName is a parsed resource name of a Firestore document or a GCS object, as found
+// in event metadata or `name` of Firestore values. For example:
+//
+//	projects/p/databases/(default)/documents/novels/abc/reviews/xyz
+//	projects/_/buckets/b/objects/novels/abc/cover.orig
+type ResourceName struct {
+	Project  string // `_` for GCS objects
+	Database string // only set for Firestore documents
+	Bucket   string // only set for GCS objects
+	// Path is the document path within database or the object name within bucket,
+	// e.g. `novels/abc/reviews/xyz`.
+	Path string
+}
+
+// ParseResourceName parses resource name of a Firestore document or a GCS object.
+func ParseResourceName(name string) (*ResourceName, error) {
+	parts := strings.SplitN(name, "/", 6)
+	if len(parts) < 5 || parts[0] != "projects" || parts[1] == "" || parts[3] == "" {
+		return nil, fmt.Errorf("gcp: invalid resource name %q", name)
+	}
+
+	r := &ResourceName{Project: parts[1]}
+	switch {
+	case parts[2] == "databases" && parts[4] == "documents":
+		r.Database = parts[3]
+	case parts[2] == "buckets" && parts[4] == "objects":
+		r.Bucket = parts[3]
+	default:
+		return nil, fmt.Errorf("gcp: unsupported resource name %q", name)
+	}
+	if len(parts) == 6 {
+		r.Path = parts[5]
+	}
+	return r, nil
+}
+
+// ResourceFromContext parses resource name of the resource that triggered the event,
+// based on metadata specified in context.
+func ResourceFromContext(ctx context.Context) (*ResourceName, error) {
+	meta, err := metadata.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Resource == nil {
+		return nil, errors.New("gcp: metadata holds no resource")
+	}
+	name := meta.Resource.Name
+	if name == "" {
+		name = meta.Resource.RawPath
+	}
+	return ParseResourceName(name)
+}
+
+// Segments returns slash separated segments of Path: collection and document IDs in turns
+// for Firestore documents.
+func (r *ResourceName) Segments() []string {
+	if r.Path == "" {
+		return nil
+	}
+	return strings.Split(r.Path, "/")
+}
+
+// ID returns the last segment of Path, which is the document ID for Firestore documents.
+func (r *ResourceName) ID() string {
+	return r.Path[strings.LastIndex(r.Path, "/")+1:]
+}
+
+// CollectionPath returns path of the collection holding the Firestore document, e.g. `novels/abc/reviews`.
+func (r *ResourceName) CollectionPath() string {
+	if i := strings.LastIndex(r.Path, "/"); i >= 0 {
+		return r.Path[:i]
+	}
+	return ""
+}
+
+// Parent returns resource name of the Firestore document holding collection of this document,
+// or nil for documents in top level collections.
+func (r *ResourceName) Parent() *ResourceName {
+	i := strings.LastIndex(r.CollectionPath(), "/")
+	if i < 0 {
+		return nil
+	}
+	parent := *r
+	parent.Path = r.Path[:i]
+	return &parent
+}
+
+// Match matches Path against pattern, returning the bound parameters.
+func (r *ResourceName) Match(p *Pattern) (Params, bool) {
+	return p.Match(r.Path)
+}
+
+func (r *ResourceName) String() string {
+	var name string
+	if r.Bucket != "" {
+		name = fmt.Sprintf("projects/%v/buckets/%v/objects", r.Project, r.Bucket)
+	} else {
+		name = fmt.Sprintf("projects/%v/databases/%v/documents", r.Project, r.Database)
+	}
+	if r.Path != "" {
+		name += "/" + r.Path
+	}
+	return name
+}
@@ -0,0 +1,42 @@
+package gcp
+
+import "testing"
+
+func TestResourceName(t *testing.T) {
+	r, err := ParseResourceName("projects/p/databases/(default)/documents/novels/abc/reviews/xyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Project != "p" || r.Database != "(default)" || r.ID() != "xyz" || r.CollectionPath() != "novels/abc/reviews" {
+		t.Errorf("ParseResourceName = %+v", r)
+	}
+	if parent := r.Parent(); parent == nil || parent.String() != "projects/p/databases/(default)/documents/novels/abc" {
+		t.Errorf("Parent = %v", parent)
+	}
+	if r.Parent().Parent() != nil {
+		t.Error("top level document has a parent")
+	}
+	params, ok := r.Match(MustParsePattern("novels/{novelId}/reviews/{reviewId}"))
+	if !ok || params["novelId"] != "abc" || params["reviewId"] != "xyz" {
+		t.Errorf("Match = %v, %v", params, ok)
+	}
+
+	obj, err := ParseResourceName("projects/_/buckets/b/objects/users/u1/avatar.orig")
+	if err != nil || obj.Bucket != "b" || obj.Path != "users/u1/avatar.orig" {
+		t.Fatalf("ParseResourceName = %+v, %v", obj, err)
+	}
+	if _, ok := obj.Match(MustParsePattern("novels/{novelId}/cover.orig")); ok {
+		t.Error("matched different path")
+	}
+	params, ok = MustParsePattern("users/{uid}/{file=**}").Match(obj.Path)
+	if !ok || params["uid"] != "u1" || params["file"] != "avatar.orig" {
+		t.Errorf("Match = %v, %v", params, ok)
+	}
+
+	if _, err := ParseResourceName("novels/abc"); err == nil {
+		t.Error("expected error for invalid resource name")
+	}
+	if _, err := ParsePattern("novels/{novelId}.jpg"); err == nil {
+		t.Error("expected error for partial wildcard")
+	}
+}
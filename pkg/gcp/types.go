@@ -19,7 +19,7 @@ type StringValue struct {
 
 // IntegerValue is a type for parsing `integer` type from Firestore Events
 type IntegerValue struct {
-	IntegerValue int64 `json:"integerValue"`
+	IntegerValue int64 `json:"integerValue,string"` // int64 is encoded as a string
 }
 
 // TimestampValue is a type for parsing `Timestamp` type from Firestore Events
@@ -0,0 +1,216 @@
+package gcp
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+var (
+	typeOfTime   = reflect.TypeOf(time.Time{})
+	typeOfLatLng = reflect.TypeOf((*latlng.LatLng)(nil))
+	typeOfValue  = reflect.TypeOf(Value{})
+	typeOfBytes  = reflect.TypeOf([]byte(nil))
+)
+
+// Unmarshal decodes fields of a Firestore Event into v, which must be a pointer to a struct or a map.
+// Struct fields are matched using the same `firestore` tags the Firestore client uses, so the same
+// domain types can be used for reading both documents and events. Fields of type Value are set as is.
+func Unmarshal(fields Fields, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("gcp: Unmarshal requires a non-nil pointer")
+	}
+	return decodeValue(rv.Elem(), Value{Type: MapType, MapValue: fields}, "")
+}
+
+// DataTo decodes fields of this value into v, like DocumentSnapshot.DataTo of the Firestore client.
+func (fv FirestoreValue) DataTo(v interface{}) error {
+	return Unmarshal(fv.Fields, v)
+}
+
+func decodeValue(dst reflect.Value, v Value, path string) error {
+	if dst.Type() == typeOfValue {
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if v.Type == NullType {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("gcp: cannot decode %v into %v at `%v`", v.Type, dst.Type(), path)
+	}
+
+	switch dst.Type() {
+	case typeOfTime:
+		if v.Type != TimestampType {
+			return mismatch()
+		}
+		dst.Set(reflect.ValueOf(v.TimestampValue))
+		return nil
+	case typeOfLatLng:
+		if v.Type != GeoPointType {
+			return mismatch()
+		}
+		dst.Set(reflect.ValueOf(v.GeoPointValue))
+		return nil
+	case typeOfBytes:
+		if v.Type != BytesType {
+			return mismatch()
+		}
+		dst.SetBytes(v.BytesValue)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeValue(dst.Elem(), v, path)
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return mismatch()
+		}
+		if elem := v.Interface(); elem != nil {
+			dst.Set(reflect.ValueOf(elem))
+		}
+		return nil
+	case reflect.Bool:
+		if v.Type != BooleanType {
+			return mismatch()
+		}
+		dst.SetBool(v.BooleanValue)
+	case reflect.String:
+		switch v.Type {
+		case StringType:
+			dst.SetString(v.StringValue)
+		case ReferenceType:
+			dst.SetString(v.ReferenceValue)
+		default:
+			return mismatch()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type != IntegerType {
+			return mismatch()
+		}
+		if dst.OverflowInt(v.IntegerValue) {
+			return fmt.Errorf("gcp: %v overflows %v at `%v`", v.IntegerValue, dst.Type(), path)
+		}
+		dst.SetInt(v.IntegerValue)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Type != IntegerType {
+			return mismatch()
+		}
+		if v.IntegerValue < 0 || dst.OverflowUint(uint64(v.IntegerValue)) {
+			return fmt.Errorf("gcp: %v overflows %v at `%v`", v.IntegerValue, dst.Type(), path)
+		}
+		dst.SetUint(uint64(v.IntegerValue))
+	case reflect.Float32, reflect.Float64:
+		f, ok := v.Float()
+		if !ok {
+			return mismatch()
+		}
+		dst.SetFloat(f)
+	case reflect.Slice:
+		if v.Type != ArrayType {
+			return mismatch()
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(v.ArrayValue), len(v.ArrayValue))
+		for i, elem := range v.ArrayValue {
+			if err := decodeValue(slice.Index(i), elem, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+	case reflect.Array:
+		if v.Type != ArrayType {
+			return mismatch()
+		}
+		dst.Set(reflect.Zero(dst.Type()))
+		for i, elem := range v.ArrayValue {
+			if i >= dst.Len() {
+				break
+			}
+			if err := decodeValue(dst.Index(i), elem, fmt.Sprintf("%v[%v]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type != MapType || dst.Type().Key().Kind() != reflect.String {
+			return mismatch()
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		for k, elem := range v.MapValue {
+			mv := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeValue(mv, elem, joinPath(path, k)); err != nil {
+				return err
+			}
+			dst.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), mv)
+		}
+	case reflect.Struct:
+		if v.Type != MapType {
+			return mismatch()
+		}
+		return decodeStruct(dst, v.MapValue, path)
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// decodeStruct sets fields of the struct dst, naming them the way the Firestore client does:
+// by the name in `firestore` tag if present, skipping fields tagged with `-` and flattening
+// embedded structs without a tag.
+func decodeStruct(dst reflect.Value, fields Fields, path string) error {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue // unexported
+		}
+
+		tag := sf.Tag.Get("firestore")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			if err := decodeStruct(dst.Field(i), fields, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		v, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(dst.Field(i), v, joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
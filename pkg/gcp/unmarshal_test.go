@@ -0,0 +1,63 @@
+package gcp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnmarshal(t *testing.T) {
+	type Author struct {
+		UID         string `firestore:"uid"`
+		DisplayName string `firestore:"displayName"`
+	}
+	type Meta struct {
+		Published bool `firestore:"published"`
+	}
+	type Novel struct {
+		Meta
+		Title     string                 `firestore:"title"`
+		Author    Author                 `firestore:"author"`
+		Genres    []string               `firestore:"genres"`
+		Chapters  int                    `firestore:"chapters"`
+		Rating    float64                `firestore:"rating"`
+		Cover     *string                `firestore:"cover"`
+		CreatedAt time.Time              `firestore:"createdAt,omitempty"`
+		Owner     string                 `firestore:"owner"`
+		Extra     map[string]interface{} `firestore:"extra"`
+		Location  Value                  `firestore:"location"`
+		Ignored   string                 `firestore:"-"`
+	}
+
+	var e FirestoreEvent
+	if err := json.Unmarshal([]byte(novelEvent), &e); err != nil {
+		t.Fatal(err)
+	}
+	var novel Novel
+	if err := e.Value.DataTo(&novel); err != nil {
+		t.Fatal(err)
+	}
+	want := Novel{
+		Meta:      Meta{Published: true},
+		Title:     "Novel",
+		Author:    Author{UID: "u1", DisplayName: "Author"},
+		Genres:    []string{"fantasy", "drama"},
+		Chapters:  42,
+		Rating:    4.5,
+		CreatedAt: time.Date(2019, 12, 8, 23, 53, 41, 0, time.UTC),
+		Owner:     "projects/p/databases/(default)/documents/users/u1",
+		Extra:     map[string]interface{}{},
+		Location:  e.Value.Fields["location"],
+	}
+	if !reflect.DeepEqual(novel, want) {
+		t.Errorf("DataTo:\n got %+v\nwant %+v", novel, want)
+	}
+
+	var wrong struct {
+		Author string `firestore:"author"`
+	}
+	if err := Unmarshal(e.Value.Fields, &wrong); err == nil {
+		t.Error("expected error decoding a map into string")
+	}
+}
@@ -0,0 +1,347 @@
+package gcp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/type/latlng"
+)
+
+// ValueType identifies which of the Firestore types a Value holds.
+type ValueType int
+
+// Firestore value types, as named on the wire (without the `Value` suffix)
+const (
+	UnsetType ValueType = iota // field isn't present at all
+	NullType
+	BooleanType
+	IntegerType
+	DoubleType
+	TimestampType
+	StringType
+	BytesType
+	ReferenceType
+	GeoPointType
+	ArrayType
+	MapType
+)
+
+var valueTypeNames = map[string]ValueType{
+	"nullValue":      NullType,
+	"booleanValue":   BooleanType,
+	"integerValue":   IntegerType,
+	"doubleValue":    DoubleType,
+	"timestampValue": TimestampType,
+	"stringValue":    StringType,
+	"bytesValue":     BytesType,
+	"referenceValue": ReferenceType,
+	"geoPointValue":  GeoPointType,
+	"arrayValue":     ArrayType,
+	"mapValue":       MapType,
+}
+
+func (t ValueType) String() string {
+	for name, vt := range valueTypeNames {
+		if vt == t {
+			return strings.TrimSuffix(name, "Value")
+		}
+	}
+	return "unset"
+}
+
+// Fields holds (possibly nested) fields of a Firestore document, as sent in Firestore Events.
+type Fields map[string]Value
+
+// Value is a union of all the types a field can hold in Firestore Events.
+// Type tells which of the other fields is set.
+type Value struct {
+	Type ValueType
+
+	BooleanValue   bool
+	IntegerValue   int64
+	DoubleValue    float64
+	TimestampValue time.Time
+	StringValue    string
+	BytesValue     []byte
+	ReferenceValue string // resource name of the referenced document
+	GeoPointValue  *latlng.LatLng
+	ArrayValue     []Value
+	MapValue       Fields
+}
+
+// UnmarshalJSON decodes a Firestore Event value, such as `{"integerValue": "42"}`.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var wire map[string]json.RawMessage
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	if len(wire) != 1 {
+		return fmt.Errorf("gcp: value must hold exactly one type, got %s", data)
+	}
+
+	*v = Value{}
+	for name, raw := range wire {
+		t, ok := valueTypeNames[name]
+		if !ok {
+			return fmt.Errorf("gcp: unknown value type %q", name)
+		}
+		v.Type = t
+
+		var err error
+		switch t {
+		case NullType:
+			return nil
+		case BooleanType:
+			err = json.Unmarshal(raw, &v.BooleanValue)
+		case IntegerType:
+			// int64 is encoded as a string, but accept numbers too
+			var s json.Number
+			if err = json.Unmarshal(raw, &s); err == nil {
+				v.IntegerValue, err = strconv.ParseInt(s.String(), 10, 64)
+			}
+		case DoubleType:
+			v.DoubleValue, err = unmarshalDouble(raw)
+		case TimestampType:
+			err = json.Unmarshal(raw, &v.TimestampValue)
+		case StringType:
+			err = json.Unmarshal(raw, &v.StringValue)
+		case BytesType:
+			var s string
+			if err = json.Unmarshal(raw, &s); err == nil {
+				v.BytesValue, err = base64.StdEncoding.DecodeString(s)
+			}
+		case ReferenceType:
+			err = json.Unmarshal(raw, &v.ReferenceValue)
+		case GeoPointType:
+			v.GeoPointValue = &latlng.LatLng{}
+			err = json.Unmarshal(raw, v.GeoPointValue)
+		case ArrayType:
+			var array struct {
+				Values []Value `json:"values"`
+			}
+			err = json.Unmarshal(raw, &array)
+			v.ArrayValue = array.Values
+		case MapType:
+			var m struct {
+				Fields Fields `json:"fields"`
+			}
+			err = json.Unmarshal(raw, &m)
+			v.MapValue = m.Fields
+			if v.MapValue == nil {
+				v.MapValue = Fields{} // empty maps omit `fields`
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("gcp: decoding %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// unmarshalDouble decodes a double, which is a JSON number unless it's one of `NaN`, `Infinity` or `-Infinity`.
+func unmarshalDouble(raw json.RawMessage) (float64, error) {
+	var f float64
+	if err := json.Unmarshal(raw, &f); err == nil {
+		return f, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, err
+	}
+	switch s {
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// IsSet reports whether the value is present, even if it's null.
+func (v Value) IsSet() bool {
+	return v.Type != UnsetType
+}
+
+// IsNull reports whether the value is null.
+func (v Value) IsNull() bool {
+	return v.Type == NullType
+}
+
+// Bool returns the boolean value, and whether the value is boolean.
+func (v Value) Bool() (bool, bool) {
+	return v.BooleanValue, v.Type == BooleanType
+}
+
+// Int returns the integer value, and whether the value is an integer.
+func (v Value) Int() (int64, bool) {
+	return v.IntegerValue, v.Type == IntegerType
+}
+
+// Float returns the value as float64, and whether the value is a number (double or integer).
+func (v Value) Float() (float64, bool) {
+	if v.Type == IntegerType {
+		return float64(v.IntegerValue), true
+	}
+	return v.DoubleValue, v.Type == DoubleType
+}
+
+// Time returns the timestamp value, and whether the value is a timestamp.
+func (v Value) Time() (time.Time, bool) {
+	return v.TimestampValue, v.Type == TimestampType
+}
+
+// Str returns the string value, and whether the value is a string.
+func (v Value) Str() (string, bool) {
+	return v.StringValue, v.Type == StringType
+}
+
+// Bytes returns the bytes value, and whether the value is bytes.
+func (v Value) Bytes() ([]byte, bool) {
+	return v.BytesValue, v.Type == BytesType
+}
+
+// Reference returns resource name of the referenced document, and whether the value is a reference.
+func (v Value) Reference() (string, bool) {
+	return v.ReferenceValue, v.Type == ReferenceType
+}
+
+// GeoPoint returns the geo point value, and whether the value is a geo point.
+func (v Value) GeoPoint() (*latlng.LatLng, bool) {
+	return v.GeoPointValue, v.Type == GeoPointType
+}
+
+// Array returns the elements of an array value, and whether the value is an array.
+func (v Value) Array() ([]Value, bool) {
+	return v.ArrayValue, v.Type == ArrayType
+}
+
+// Map returns the fields of a map value, and whether the value is a map.
+func (v Value) Map() (Fields, bool) {
+	return v.MapValue, v.Type == MapType
+}
+
+// Get returns the nested value at the dot separated path (e.g. `author.uid`),
+// or an unset Value if there's none.
+func (v Value) Get(path string) Value {
+	if v.Type != MapType {
+		return Value{}
+	}
+	return v.MapValue.Get(path)
+}
+
+// Equal reports whether both values are of the same type and hold the same data.
+func (v Value) Equal(o Value) bool {
+	if v.Type != o.Type {
+		return false
+	}
+	switch v.Type {
+	case BooleanType:
+		return v.BooleanValue == o.BooleanValue
+	case IntegerType:
+		return v.IntegerValue == o.IntegerValue
+	case DoubleType:
+		return v.DoubleValue == o.DoubleValue || (math.IsNaN(v.DoubleValue) && math.IsNaN(o.DoubleValue))
+	case TimestampType:
+		return v.TimestampValue.Equal(o.TimestampValue)
+	case StringType:
+		return v.StringValue == o.StringValue
+	case BytesType:
+		return bytes.Equal(v.BytesValue, o.BytesValue)
+	case ReferenceType:
+		return v.ReferenceValue == o.ReferenceValue
+	case GeoPointType:
+		return v.GeoPointValue.GetLatitude() == o.GeoPointValue.GetLatitude() &&
+			v.GeoPointValue.GetLongitude() == o.GeoPointValue.GetLongitude()
+	case ArrayType:
+		if len(v.ArrayValue) != len(o.ArrayValue) {
+			return false
+		}
+		for i := range v.ArrayValue {
+			if !v.ArrayValue[i].Equal(o.ArrayValue[i]) {
+				return false
+			}
+		}
+		return true
+	case MapType:
+		if len(v.MapValue) != len(o.MapValue) {
+			return false
+		}
+		for k, elem := range v.MapValue {
+			if !elem.Equal(o.MapValue[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return true // unset or null
+}
+
+// Interface converts the value into a plain Go value, as read by the Firestore client: nil, bool, int64,
+// float64, time.Time, string, []byte, *latlng.LatLng, []interface{} or map[string]interface{}.
+// References are returned as resource names.
+func (v Value) Interface() interface{} {
+	switch v.Type {
+	case BooleanType:
+		return v.BooleanValue
+	case IntegerType:
+		return v.IntegerValue
+	case DoubleType:
+		return v.DoubleValue
+	case TimestampType:
+		return v.TimestampValue
+	case StringType:
+		return v.StringValue
+	case BytesType:
+		return v.BytesValue
+	case ReferenceType:
+		return v.ReferenceValue
+	case GeoPointType:
+		return v.GeoPointValue
+	case ArrayType:
+		array := make([]interface{}, len(v.ArrayValue))
+		for i, elem := range v.ArrayValue {
+			array[i] = elem.Interface()
+		}
+		return array
+	case MapType:
+		return v.MapValue.Interface()
+	}
+	return nil
+}
+
+// Get returns the value at the dot separated path (e.g. `author.uid`), or an unset Value if there's none.
+// Field names that aren't simple identifiers are quoted with backticks, as in update masks.
+func (f Fields) Get(path string) Value {
+	return f.getPath(SplitPath(path))
+}
+
+func (f Fields) getPath(path []string) Value {
+	if len(path) == 0 {
+		return Value{}
+	}
+	v, ok := f[path[0]]
+	if !ok || len(path) == 1 {
+		return v
+	}
+	if v.Type != MapType {
+		return Value{}
+	}
+	return v.MapValue.getPath(path[1:])
+}
+
+// Interface converts the fields into plain Go values, as read by the Firestore client.
+func (f Fields) Interface() map[string]interface{} {
+	m := make(map[string]interface{}, len(f))
+	for k, v := range f {
+		m[k] = v.Interface()
+	}
+	return m
+}
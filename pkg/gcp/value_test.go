@@ -0,0 +1,91 @@
+package gcp
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const novelEvent = `{
+	"oldValue": {},
+	"value": {
+		"name": "projects/p/databases/(default)/documents/novels/abc",
+		"createTime": "2019-12-08T23:53:41.123456Z",
+		"updateTime": "2019-12-08T23:53:41.123456Z",
+		"fields": {
+			"title": {"stringValue": "Novel"},
+			"author": {"mapValue": {"fields": {
+				"uid": {"stringValue": "u1"},
+				"displayName": {"stringValue": "Author"}
+			}}},
+			"genres": {"arrayValue": {"values": [{"stringValue": "fantasy"}, {"stringValue": "drama"}]}},
+			"tags": {"arrayValue": {}},
+			"extra": {"mapValue": {}},
+			"chapters": {"integerValue": "42"},
+			"rating": {"doubleValue": 4.5},
+			"score": {"doubleValue": "NaN"},
+			"published": {"booleanValue": true},
+			"cover": {"nullValue": null},
+			"createdAt": {"timestampValue": "2019-12-08T23:53:41Z"},
+			"thumb": {"bytesValue": "aGVsbG8="},
+			"owner": {"referenceValue": "projects/p/databases/(default)/documents/users/u1"},
+			"location": {"geoPointValue": {"latitude": 46.05, "longitude": 14.5}}
+		}
+	},
+	"updateMask": {}
+}`
+
+func TestValueUnmarshal(t *testing.T) {
+	var e FirestoreEvent
+	if err := json.Unmarshal([]byte(novelEvent), &e); err != nil {
+		t.Fatal(err)
+	}
+	fields := e.Value.Fields
+
+	if s, ok := fields.Get("author.displayName").Str(); !ok || s != "Author" {
+		t.Errorf("author.displayName = %v, %v", s, ok)
+	}
+	if i, ok := fields["chapters"].Int(); !ok || i != 42 {
+		t.Errorf("chapters = %v, %v", i, ok)
+	}
+	if f, ok := fields["chapters"].Float(); !ok || f != 42 {
+		t.Errorf("chapters as float = %v, %v", f, ok)
+	}
+	if f, _ := fields["score"].Float(); !math.IsNaN(f) {
+		t.Errorf("score = %v, want NaN", f)
+	}
+	if !fields["cover"].IsNull() || fields["missing"].IsSet() {
+		t.Error("null and unset values are not told apart")
+	}
+	if b, _ := fields["thumb"].Bytes(); string(b) != "hello" {
+		t.Errorf("thumb = %q", b)
+	}
+	if p, ok := fields["location"].GeoPoint(); !ok || p.Latitude != 46.05 {
+		t.Errorf("location = %v", p)
+	}
+	if m, ok := fields["extra"].Map(); !ok || m == nil {
+		t.Errorf("empty map = %v, %v", m, ok)
+	}
+
+	want := map[string]interface{}{
+		"title":     "Novel",
+		"author":    map[string]interface{}{"uid": "u1", "displayName": "Author"},
+		"genres":    []interface{}{"fantasy", "drama"},
+		"tags":      []interface{}{},
+		"published": true,
+		"cover":     nil,
+		"createdAt": time.Date(2019, 12, 8, 23, 53, 41, 0, time.UTC),
+	}
+	got := fields.Interface()
+	for k, v := range want {
+		if !reflect.DeepEqual(got[k], v) {
+			t.Errorf("Interface()[%v] = %#v, want %#v", k, got[k], v)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"stringValue": "a", "integerValue": "1"}`), &Value{}); err == nil {
+		t.Error("expected error for value holding multiple types")
+	}
+}
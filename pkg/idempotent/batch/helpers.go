@@ -2,23 +2,84 @@ package batch
 
 import (
 	"context"
-	"time"
+	"errors"
 
 	"cloud.google.com/go/firestore"
 	"github.com/makuc/a-novels-backend/pkg/idempotent"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 )
 
-// ExecuteMarkCompleteBatch marks indempotent function as complete based
-// on EventID specified in context metadata
-func ExecuteMarkCompleteBatch(ctx context.Context, bx *firestore.WriteBatch) error {
-	ref, err := idempotent.GetExecuteProgressRef(ctx)
+// ErrProgressConflict is returned by CommitBatch when the record tracking progress changed before the batch
+// was committed (e.g. the lease was renewed by the heartbeat), while the lease is still held. None of the
+// writes were made, so they have to be prepared again, in a new batch.
+var ErrProgressConflict = errors.New("progress record changed before commit")
+
+// ExecuteMarkCompleteBatch marks indempotent function as complete, unless
+// the lease was meanwhile granted to another execution
+func ExecuteMarkCompleteBatch(ctx context.Context, store *idempotent.FirestoreStore, lease *idempotent.Lease, bx *firestore.WriteBatch) error {
+	data, err := idempotent.CompleteProgress()
 	if err != nil {
 		return err
 	}
-	bx.Set(ref, map[string]interface{}{
-		"done":      true,
-		"updatedAt": time.Now(),
-	}, firestore.MergeAll)
+	return SetExecuteProgressBatch(ctx, store, lease, bx, data)
+}
+
+// SetExecuteProgressBatch merges data into progress of indempotent completion of this function,
+// unless the lease was meanwhile granted to another execution. Since batches can't read, the
+// fencing token is checked when adding the write, and the write is preconditioned on the record
+// not changing until commit - so the whole batch fails if the lease is lost meanwhile. Commit
+// the batch with CommitBatch, telling a lost lease apart from other changes of the record.
+func SetExecuteProgressBatch(ctx context.Context, store *idempotent.FirestoreStore, lease *idempotent.Lease, bx *firestore.WriteBatch, data map[string]interface{}) error {
+	ref := store.Ref(lease.Key)
+	doc, err := ref.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if err := idempotent.CheckToken(doc.Data(), lease); err != nil {
+		return err
+	}
+	bx.Update(ref, mergeUpdates(nil, data), firestore.LastUpdateTime(doc.UpdateTime))
 
 	return nil
 }
+
+// SaveCheckpointBatch saves checkpoint into progress of this execution, unless
+// the lease was meanwhile granted to another execution
+func SaveCheckpointBatch(ctx context.Context, store *idempotent.FirestoreStore, lease *idempotent.Lease, bx *firestore.WriteBatch, cp *idempotent.Checkpoint) error {
+	return SetExecuteProgressBatch(ctx, store, lease, bx, cp.Progress())
+}
+
+// CommitBatch commits bx, holding a progress write added with SetExecuteProgressBatch. When the record tracking
+// progress changed meanwhile, it returns idempotent.ErrStaleToken if the lease was granted to another execution,
+// or ErrProgressConflict otherwise.
+func CommitBatch(ctx context.Context, store *idempotent.FirestoreStore, lease *idempotent.Lease, bx *firestore.WriteBatch) error {
+	_, err := bx.Commit(ctx)
+	if grpc.Code(err) != codes.FailedPrecondition {
+		return err
+	}
+
+	doc, getErr := store.Ref(lease.Key).Get(ctx)
+	if getErr != nil {
+		return err
+	}
+	if tokenErr := idempotent.CheckToken(doc.Data(), lease); tokenErr != nil {
+		return tokenErr
+	}
+	return ErrProgressConflict
+}
+
+// mergeUpdates flattens nested maps of data into updates of their leaf fields, so the update
+// merges data the same way as Set with firestore.MergeAll.
+func mergeUpdates(prefix firestore.FieldPath, data map[string]interface{}) []firestore.Update {
+	var updates []firestore.Update
+	for k, v := range data {
+		path := append(append(firestore.FieldPath{}, prefix...), k)
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			updates = append(updates, mergeUpdates(path, nested)...)
+			continue
+		}
+		updates = append(updates, firestore.Update{FieldPath: path, Value: v})
+	}
+	return updates
+}
@@ -0,0 +1,109 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/makuc/a-novels-backend/pkg/idempotent"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// emulatorStore returns a store in a fresh collection of the Firestore emulator, skipping
+// the test when `FIRESTORE_EMULATOR_HOST` isn't set.
+func emulatorStore(t *testing.T) (*firestore.Client, *idempotent.FirestoreStore) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST not set")
+	}
+	client, err := firestore.NewClient(context.Background(), "test-project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection := fmt.Sprintf("batch-test-%v", time.Now().UnixNano())
+	return client, idempotent.NewFirestoreStore(client, collection)
+}
+
+func TestCommitBatch(t *testing.T) {
+	client, store := emulatorStore(t)
+	defer client.Close()
+	ctx := context.Background()
+	cp := &idempotent.Checkpoint{Name: "novels", Done: true}
+
+	// Lease expires right away, so another execution can take over
+	lease, err := store.Acquire(ctx, "event-1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sideEffect := store.Collection().Doc("side-effect")
+	bx := client.Batch()
+	bx.Set(sideEffect, map[string]interface{}{"written": true})
+	if err := SaveCheckpointBatch(ctx, store, lease, bx, cp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Token advances between adding the write and committing
+	if _, err := store.Acquire(ctx, "event-1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitBatch(ctx, store, lease, bx); err != idempotent.ErrStaleToken {
+		t.Errorf("CommitBatch = %v, want ErrStaleToken", err)
+	}
+	if _, err := sideEffect.Get(ctx); grpc.Code(err) != codes.NotFound {
+		t.Errorf("side effect of stale batch committed: %v", err)
+	}
+	progress, err := store.Progress(ctx, "event-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := idempotent.ParseCheckpoint(progress, "novels"); got.Done {
+		t.Error("checkpoint of stale batch saved")
+	}
+}
+
+func TestCommitBatchConflict(t *testing.T) {
+	client, store := emulatorStore(t)
+	defer client.Close()
+	ctx := context.Background()
+
+	lease, err := store.Acquire(ctx, "event-1", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bx := client.Batch()
+	if err := SetExecuteProgressBatch(ctx, store, lease, bx, map[string]interface{}{"count": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renewing the lease changes the record, but the lease is still ours
+	if err := store.Renew(ctx, lease, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitBatch(ctx, store, lease, bx); err != ErrProgressConflict {
+		t.Errorf("CommitBatch = %v, want ErrProgressConflict", err)
+	}
+}
+
+func TestMergeUpdates(t *testing.T) {
+	updates := mergeUpdates(nil, map[string]interface{}{
+		"steps": map[string]interface{}{
+			"novels": map[string]interface{}{"done": true},
+		},
+		"empty": map[string]interface{}{},
+	})
+	got := map[string]interface{}{}
+	for _, u := range updates {
+		got[fmt.Sprint(u.FieldPath)] = u.Value
+	}
+	want := map[string]interface{}{
+		"[steps novels done]": true,
+		"[empty]":             map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeUpdates = %v, want %v", got, want)
+	}
+}
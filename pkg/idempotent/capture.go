@@ -0,0 +1,73 @@
+package idempotent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+// ExecuteCapture persists the raw event payload e and metadata alongside the lease, so a failed event
+// can later be reproduced (see cmd/replay). Capturing is opt-in, enabled with env variable `capturePayload`.
+func ExecuteCapture(ctx context.Context, store LeaseStore, lease *Lease, e interface{}) error {
+	if !CapturePayload() {
+		return nil
+	}
+	event, err := EncodeEvent(ctx, e)
+	if err != nil {
+		return err
+	}
+	return store.SetProgress(ctx, lease, event)
+}
+
+// CapturePayload reports whether event payloads are persisted alongside leases,
+// configured with env variable `capturePayload`.
+func CapturePayload() bool {
+	capture, _ := strconv.ParseBool(os.Getenv("capturePayload"))
+	return capture
+}
+
+// EncodeEvent encodes event payload e and metadata as JSON, as expected by DecodeEvent.
+func EncodeEvent(ctx context.Context, e interface{}) (map[string]interface{}, error) {
+	meta, err := metadata.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	payloadJSON, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"eventId":   meta.EventID,
+		"eventType": meta.EventType,
+		"metadata":  string(metaJSON),
+		"payload":   string(payloadJSON),
+	}, nil
+}
+
+// DecodeEvent decodes the event captured by EncodeEvent, returning a context
+// carrying its metadata and the raw JSON payload.
+func DecodeEvent(ctx context.Context, data map[string]interface{}) (context.Context, []byte, error) {
+	metaJSON, ok := data["metadata"].(string)
+	if !ok {
+		return nil, nil, errors.New("no metadata captured")
+	}
+	payloadJSON, ok := data["payload"].(string)
+	if !ok {
+		return nil, nil, errors.New("no payload captured")
+	}
+
+	meta := &metadata.Metadata{}
+	if err := json.Unmarshal([]byte(metaJSON), meta); err != nil {
+		return nil, nil, err
+	}
+	return metadata.NewContext(ctx, meta), []byte(payloadJSON), nil
+}
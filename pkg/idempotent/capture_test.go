@@ -0,0 +1,48 @@
+package idempotent
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+func TestExecuteCapture(t *testing.T) {
+	defer os.Unsetenv("capturePayload")
+
+	store := NewMemoryStore()
+	ctx := eventContext("event-1")
+	lease, err := ExecuteWithLease(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := map[string]string{"name": "novels/abc/cover.orig"}
+
+	// Capturing is opt-in
+	if err := ExecuteCapture(ctx, store, lease, payload); err != nil {
+		t.Fatal(err)
+	}
+	if progress, _ := GetExecuteProgress(ctx, store); progress["payload"] != nil {
+		t.Error("payload captured without opting in")
+	}
+
+	os.Setenv("capturePayload", "true")
+	if err := ExecuteCapture(ctx, store, lease, payload); err != nil {
+		t.Fatal(err)
+	}
+	progress, err := GetExecuteProgress(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayCtx, raw, err := DecodeEvent(context.Background(), progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != `{"name":"novels/abc/cover.orig"}` {
+		t.Errorf("payload = %s", raw)
+	}
+	if meta, err := metadata.FromContext(replayCtx); err != nil || meta.EventID != "event-1" {
+		t.Errorf("metadata = %v, err = %v", meta, err)
+	}
+}
@@ -0,0 +1,143 @@
+package idempotent
+
+import (
+	"context"
+	"time"
+)
+
+// Checkpoint tracks progress of a single named step of an execution, so that
+// a multi-step function can resume exactly where its previous attempt stopped.
+// Checkpoints are kept in the progress document, under `steps.<name>`.
+type Checkpoint struct {
+	// Name of the step.
+	Name string
+	// Done marks the step as complete.
+	Done bool
+	// Cursor marks position within the step, e.g. last processed document.
+	Cursor interface{}
+	// State holds any additional data the step needs to resume.
+	State map[string]interface{}
+}
+
+// GetCheckpoint returns checkpoint of the named step of this execution based on EventID specified
+// in context metadata. Steps that weren't started yet return an empty Checkpoint.
+func GetCheckpoint(ctx context.Context, store LeaseStore, name string) (*Checkpoint, error) {
+	progress, err := GetExecuteProgress(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := ParseCheckpoint(progress, name)
+	if corrupt, ok := err.(*CorruptRecordError); ok {
+		corrupt.Key, _ = EventKey(ctx)
+	}
+	return cp, err
+}
+
+// SaveCheckpoint saves checkpoint into progress of this execution,
+// unless the lease was meanwhile granted to another execution.
+func SaveCheckpoint(ctx context.Context, store LeaseStore, lease *Lease, cp *Checkpoint) error {
+	return store.SetProgress(ctx, lease, cp.Progress())
+}
+
+// ParseCheckpoint returns checkpoint of the named step from already fetched progress data.
+// Unexpected data is reported with CorruptRecordError.
+func ParseCheckpoint(progress map[string]interface{}, name string) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		Name:  name,
+		State: map[string]interface{}{},
+	}
+
+	steps, ok := progress["steps"].(map[string]interface{})
+	if !ok {
+		return cp, nil // No step was started yet
+	}
+	stepRaw, ok := steps[name]
+	if !ok {
+		return cp, nil
+	}
+	step, ok := stepRaw.(map[string]interface{})
+	if !ok {
+		return nil, &CorruptRecordError{Field: "steps." + name, Value: stepRaw}
+	}
+
+	if doneRaw, ok := step["done"]; ok {
+		if cp.Done, ok = doneRaw.(bool); !ok {
+			return nil, &CorruptRecordError{Field: "steps." + name + ".done", Value: doneRaw}
+		}
+	}
+	cp.Cursor = step["cursor"]
+	if stateRaw, ok := step["state"]; ok && stateRaw != nil {
+		if cp.State, ok = stateRaw.(map[string]interface{}); !ok {
+			return nil, &CorruptRecordError{Field: "steps." + name + ".state", Value: stateRaw}
+		}
+	}
+	return cp, nil
+}
+
+// Progress returns the checkpoint as data to be merged into the progress document.
+func (cp *Checkpoint) Progress() map[string]interface{} {
+	step := map[string]interface{}{
+		"done": cp.Done,
+	}
+	if cp.Cursor != nil {
+		step["cursor"] = cp.Cursor
+	}
+	if len(cp.State) > 0 {
+		step["state"] = cp.State
+	}
+	return map[string]interface{}{
+		"steps": map[string]interface{}{
+			cp.Name: step,
+		},
+		"updatedAt": time.Now(),
+	}
+}
+
+// CursorInt returns the cursor as an integer, or 0 if there is none.
+func (cp *Checkpoint) CursorInt() int64 {
+	val, _ := toInt(cp.Cursor)
+	return val
+}
+
+// CursorString returns the cursor as a string, or "" if there is none.
+func (cp *Checkpoint) CursorString() string {
+	val, _ := cp.Cursor.(string)
+	return val
+}
+
+// Int returns an integer saved in the state of the step.
+func (cp *Checkpoint) Int(key string) (int64, bool) {
+	return toInt(cp.State[key])
+}
+
+// String returns a string saved in the state of the step.
+func (cp *Checkpoint) String(key string) (string, bool) {
+	val, ok := cp.State[key].(string)
+	return val, ok
+}
+
+// Bool returns a boolean saved in the state of the step.
+func (cp *Checkpoint) Bool(key string) (bool, bool) {
+	val, ok := cp.State[key].(bool)
+	return val, ok
+}
+
+// Time returns a timestamp saved in the state of the step.
+func (cp *Checkpoint) Time(key string) (time.Time, bool) {
+	val, ok := cp.State[key].(time.Time)
+	return val, ok
+}
+
+// toInt converts integers as returned by Firestore (int64) or saved in memory (int).
+func toInt(raw interface{}) (int64, bool) {
+	switch val := raw.(type) {
+	case int64:
+		return val, true
+	case int:
+		return int64(val), true
+	case int32:
+		return int64(val), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,50 @@
+package idempotent
+
+import "testing"
+
+func TestCheckpoint(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := eventContext("event-1")
+	lease, err := ExecuteWithLease(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err := GetCheckpoint(ctx, store, "novels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Done || cp.Cursor != nil {
+		t.Fatalf("new checkpoint not empty: %+v", cp)
+	}
+
+	cp.Cursor = "novels/abc"
+	cp.State["processed"] = 400
+	if err := SaveCheckpoint(ctx, store, lease, cp); err != nil {
+		t.Fatal(err)
+	}
+	other := &Checkpoint{Name: "reviews", Done: true}
+	if err := SaveCheckpoint(ctx, store, lease, other); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err = GetCheckpoint(ctx, store, "novels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Done || cp.CursorString() != "novels/abc" {
+		t.Errorf("novels checkpoint: %+v", cp)
+	}
+	if n, ok := cp.Int("processed"); !ok || n != 400 {
+		t.Errorf("processed = %v, %v", n, ok)
+	}
+	if cp, _ = GetCheckpoint(ctx, store, "reviews"); !cp.Done {
+		t.Error("reviews checkpoint not done")
+	}
+
+	if _, err := ParseCheckpoint(map[string]interface{}{
+		"steps": map[string]interface{}{"novels": "corrupt"},
+	}, "novels"); err == nil {
+		t.Error("expected error for corrupt checkpoint")
+	}
+}
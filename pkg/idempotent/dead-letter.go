@@ -0,0 +1,92 @@
+package idempotent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ExecuteFailed records failure of this execution, keeping the error message in its progress
+// (stack of a recovered panic is part of it, see Wrap), and releases the lease in the same write,
+// so the retry doesn't have to wait for it to expire.
+// Once the execution was attempted MaxAttempts times (lease's Attempts), or cause isn't Retryable, the
+// event is moved to dead letters together with its payload e and nil is returned, so the platform stops
+// retrying it. Otherwise cause is returned as is, for the function to be retried. Executions stopping
+// with ErrDeadlineNear are making progress, so they're always retried and their attempt isn't counted.
+func ExecuteFailed(ctx context.Context, store LeaseStore, lease *Lease, e interface{}, cause error) error {
+	failure := map[string]interface{}{
+		"lastError": cause.Error(),
+		"lease":     time.Now(),
+		"failedAt":  time.Now(),
+		"updatedAt": time.Now(),
+	}
+	if retention, err := FailedRetention(); err == nil {
+		failure["expireAt"] = time.Now().Add(retention)
+	}
+	if cause == ErrDeadlineNear {
+		failure["attempts"] = lease.Attempts - 1 // Resuming isn't a failed attempt, give it back
+	}
+	if err := store.SetProgress(ctx, lease, failure); err != nil {
+		log.Printf("ExecuteFailed: recording failure of %v: %v", lease.Key, err)
+		return cause
+	}
+
+	maxAttempts, err := MaxAttempts()
+	if err != nil {
+		log.Printf("ExecuteFailed: %v", err)
+		return cause
+	}
+	if cause == ErrDeadlineNear || (lease.Attempts < maxAttempts && Retryable(cause)) {
+		return cause // Let the platform retry
+	}
+
+	letter, err := NewDeadLetter(ctx, lease, e)
+	if err != nil {
+		log.Printf("ExecuteFailed: preparing dead letter of %v: %v", lease.Key, err)
+		return cause
+	}
+	for k, v := range failure {
+		letter[k] = v
+	}
+	if err := store.DeadLetter(ctx, lease, letter); err != nil {
+		log.Printf("ExecuteFailed: dead-lettering %v: %v", lease.Key, err)
+		return cause
+	}
+
+	log.Printf("ExecuteFailed: %v moved to dead letters after %v attempts: %v", lease.Key, lease.Attempts, cause)
+	return nil
+}
+
+// NewDeadLetter prepares a dead letter for this execution, with event payload e
+// and metadata (both encoded as JSON), so the event can later be replayed.
+func NewDeadLetter(ctx context.Context, lease *Lease, e interface{}) (map[string]interface{}, error) {
+	event, err := EncodeEvent(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+	event["key"] = lease.Key
+	event["function"] = FunctionName()
+	event["attempts"] = lease.Attempts
+	event["deadLetteredAt"] = time.Now()
+	return event, nil
+}
+
+// MaxAttempts returns how many times an execution is attempted before being moved to
+// dead letters, configured with env variable `maxAttempts`, which has to be positive.
+func MaxAttempts() (int64, error) {
+	maxAttemptsRaw, ok := os.LookupEnv("maxAttempts")
+	if !ok {
+		return 5, nil // Default value
+	}
+	maxAttempts, err := strconv.ParseInt(maxAttemptsRaw, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if maxAttempts <= 0 {
+		return 0, fmt.Errorf("check env: maxAttempts, must be positive, got: %v", maxAttempts)
+	}
+	return maxAttempts, nil
+}
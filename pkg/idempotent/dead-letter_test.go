@@ -0,0 +1,97 @@
+package idempotent
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestExecuteFailed(t *testing.T) {
+	defer os.Unsetenv("maxAttempts")
+	os.Setenv("maxAttempts", "2")
+
+	store := NewMemoryStore()
+	ctx := eventContext("event-1")
+	payload := map[string]string{"name": "novels/abc/cover.orig"}
+	cause := errors.New("bucket is busy")
+
+	// Failed attempts release their lease, so the retry can take over right away
+	for attempt := 1; attempt <= 2; attempt++ {
+		lease, err := store.Acquire(ctx, "event-1", time.Now().Add(time.Minute))
+		if err != nil || lease == nil {
+			t.Fatalf("attempt %v: lease = %v, err = %v", attempt, lease, err)
+		}
+		err = ExecuteFailed(ctx, store, lease, payload, cause)
+		if attempt < 2 && err != cause {
+			t.Errorf("attempt %v: ExecuteFailed = %v, want cause", attempt, err)
+		}
+		if attempt == 2 && err != nil {
+			t.Errorf("attempt %v: ExecuteFailed = %v, want nil", attempt, err)
+		}
+	}
+
+	// Executions stopping before the deadline are retried regardless of attempts
+	deadlineCtx := eventContext("event-2")
+	for attempt := 1; attempt <= 3; attempt++ {
+		lease, err := store.Acquire(deadlineCtx, "event-2", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ExecuteFailed(deadlineCtx, store, lease, payload, ErrDeadlineNear); err != ErrDeadlineNear {
+			t.Errorf("attempt %v: ExecuteFailed = %v, want ErrDeadlineNear", attempt, err)
+		}
+	}
+	if _, ok := store.DeadLetters()["event-2"]; ok {
+		t.Error("event stopped by deadline dead-lettered")
+	}
+
+	// ... and don't use up attempts of real failures coming afterwards
+	for attempt := 1; attempt <= 2; attempt++ {
+		lease, err := store.Acquire(deadlineCtx, "event-2", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ExecuteFailed(deadlineCtx, store, lease, payload, cause)
+		if attempt < 2 && err != cause {
+			t.Errorf("attempt %v after deadlines: ExecuteFailed = %v, want cause", attempt, err)
+		}
+		if attempt == 2 && err != nil {
+			t.Errorf("attempt %v after deadlines: ExecuteFailed = %v, want nil", attempt, err)
+		}
+	}
+	if letter, ok := store.DeadLetters()["event-2"]; !ok || letter["attempts"] != int64(2) {
+		t.Errorf("dead letter after deadlines = %v", letter)
+	}
+
+	progress, err := GetExecuteProgress(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress["lastError"] != cause.Error() {
+		t.Errorf("failure not recorded: %v", progress)
+	}
+
+	letter, ok := store.DeadLetters()["event-1"]
+	if !ok {
+		t.Fatal("event not dead-lettered")
+	}
+	if letter["payload"] != `{"name":"novels/abc/cover.orig"}` {
+		t.Errorf("payload = %v", letter["payload"])
+	}
+	if lease, err := ExecuteWithLease(ctx, store); err != ErrDeadLettered || lease != nil {
+		t.Errorf("dead-lettered event: lease = %v, err = %v", lease, err)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	defer os.Unsetenv("maxAttempts")
+
+	// Non-positive attempts would dead-letter on the first failure
+	for _, raw := range []string{"0", "-1"} {
+		os.Setenv("maxAttempts", raw)
+		if n, err := MaxAttempts(); err == nil {
+			t.Errorf("MaxAttempts() = %v, want error for maxAttempts=%v", n, raw)
+		}
+	}
+}
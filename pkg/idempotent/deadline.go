@@ -0,0 +1,43 @@
+package idempotent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrDeadlineNear is returned by long running executions that stopped before the function times out,
+// so they're retried and continue from their checkpoints. ExecuteFailed doesn't count such attempts
+// towards MaxAttempts (see Lease.Attempts).
+var ErrDeadlineNear = errors.New("function deadline is near")
+
+// deadlineMargin is time left for saving progress, before the function times out
+const deadlineMargin = 10 * time.Second
+
+// Deadline returns the time an execution starting now should stop working at, leaving enough time to
+// save its progress. It's based on the deadline of ctx, if set, or else on the function timeout.
+func Deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(FunctionTimeout())
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return deadline.Add(-deadlineMargin)
+}
+
+// FunctionTimeout returns the timeout of the function, configured with env variable `FUNCTION_TIMEOUT_SEC`
+// (set by the runtime).
+func FunctionTimeout() time.Duration {
+	timeoutRaw, ok := os.LookupEnv("FUNCTION_TIMEOUT_SEC")
+	if !ok {
+		return 60 * time.Second // Default timeout of Cloud Functions
+	}
+	timeout, err := strconv.ParseInt(timeoutRaw, 10, 32)
+	if err != nil {
+		log.Printf("check env: FUNCTION_TIMEOUT_SEC, using default: 60")
+		return 60 * time.Second
+	}
+	return time.Second * time.Duration(timeout)
+}
@@ -0,0 +1,49 @@
+package idempotent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrAlreadyCompleted is returned when a lease is requested on an execution that was already completed.
+	ErrAlreadyCompleted = errors.New("execution already completed")
+	// ErrDeadLettered is returned when a lease is requested on an execution that was moved to dead letters.
+	ErrDeadLettered = errors.New("execution dead-lettered")
+)
+
+// LeaseHeldError is returned when the lease on an execution is currently held by another execution.
+type LeaseHeldError struct {
+	Key string
+	// RetryAfter is the time the lease expires at, unless renewed.
+	RetryAfter time.Time
+}
+
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("lease on %v is held, retry after %v", e.Key, e.RetryAfter.Format(time.RFC3339))
+}
+
+// CorruptRecordError is returned when a record tracking an execution holds a value of unexpected type.
+type CorruptRecordError struct {
+	Key   string
+	Field string
+	Value interface{}
+}
+
+func (e *CorruptRecordError) Error() string {
+	return fmt.Sprintf("corrupt record %v: unexpected `%v` of type %T", e.Key, e.Field, e.Value)
+}
+
+// Retryable reports whether the function should be retried after failing with err. Retrying is always
+// safe, so it is only ruled out when the execution was already completed, given up on, or its record
+// is corrupt - in which case retries would never succeed.
+func Retryable(err error) bool {
+	if err == nil || err == ErrAlreadyCompleted || err == ErrDeadLettered {
+		return false
+	}
+	if _, ok := err.(*CorruptRecordError); ok {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package idempotent
+
+import "testing"
+
+func TestCorruptRecord(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := eventContext("event-1")
+	key, _ := EventKey(ctx)
+	store.records[key] = map[string]interface{}{"done": "yes"}
+
+	lease, err := ExecuteWithLease(ctx, store)
+	corrupt, ok := err.(*CorruptRecordError)
+	if !ok || lease != nil {
+		t.Fatalf("lease = %v, err = %v", lease, err)
+	}
+	if corrupt.Key != key || corrupt.Field != "done" {
+		t.Errorf("corrupt = %+v", corrupt)
+	}
+	if Retryable(err) {
+		t.Error("corrupt record should not be retryable")
+	}
+
+	// Executions failing on corrupt data are dead-lettered right away
+	ctx = eventContext("event-2")
+	lease, err = ExecuteWithLease(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cause := &CorruptRecordError{Key: lease.Key, Field: "createdAt"}
+	if err := ExecuteFailed(ctx, store, lease, nil, cause); err != nil {
+		t.Errorf("ExecuteFailed = %v, expected dead-lettering", err)
+	}
+	if _, ok := store.DeadLetters()[lease.Key]; !ok {
+		t.Error("event not dead-lettered")
+	}
+}
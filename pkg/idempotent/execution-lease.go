@@ -2,81 +2,44 @@ package idempotent
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"time"
-
-	"cloud.google.com/go/firestore"
-	"cloud.google.com/go/functions/metadata"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-)
-
-var (
-	// Client variable needs to be injected a pointer to an initialized Firestore Client
-	Client *firestore.Client
 )
 
 // ExecuteWithLease tracks indempotence of the function based on the EventID specified in context metadata.
-func ExecuteWithLease(ctx context.Context) (bool, error) {
-	proceed := true
-
-	meta, err := metadata.FromContext(ctx)
+// It returns the granted lease, carrying a fencing token all further writes have to be made with.
+// Use Retryable to tell whether the function should be retried when the lease isn't granted.
+func ExecuteWithLease(ctx context.Context, store LeaseStore) (*Lease, error) {
+	key, err := EventKey(ctx)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	ref := Client.Collection("user-events").Doc(meta.EventID)
-	err = Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		doc, err := tx.Get(ref)
-		if err != nil && grpc.Code(err) != codes.NotFound {
-			return err
-		}
-		if doc.Exists() {
-			if doc.Data()["done"].(bool) { // Since this Event was already processed, just exit
-				proceed = false
-				return nil
-			}
-			getLease, err := doc.DataAt("lease")
-			if err != nil {
-				return err
-			}
-			if val, ok := getLease.(time.Time); ok && time.Now().Before(val) {
-				return errors.New("occupied, try later")
-			}
-		}
-
-		leaseSecondsRaw, ok := os.LookupEnv("leaseSeconds")
-		if !ok {
-			leaseSecondsRaw = "60" // Default value, just in case
-			log.Print("check env: leaseSeconds, using default: 60")
-		}
-		leaseSeconds, err := strconv.ParseInt(leaseSecondsRaw, 10, 32)
-		if err != nil {
-			return err
-		}
-
-		newValue := map[string]interface{}{
-			"lease":     time.Now().Add(time.Second * time.Duration(leaseSeconds)),
-			"updatedAt": time.Now(),
-		}
+	leaseDuration, err := LeaseDuration()
+	if err != nil {
+		return nil, err
+	}
 
-		_, err = doc.DataAt("createdAt")
-		if err != nil {
-			if grpc.Code(err) == codes.NotFound {
-				newValue["createdAt"] = time.Now()
-			} else {
-				return err
-			}
-		}
+	return store.Acquire(ctx, key, time.Now().Add(leaseDuration))
+}
 
-		proceed = true
-		return tx.Set(ref, newValue, firestore.MergeAll)
-	})
+// LeaseDuration returns for how long a lease is granted, configured with env variable `leaseSeconds`,
+// which has to be positive.
+func LeaseDuration() (time.Duration, error) {
+	leaseSecondsRaw, ok := os.LookupEnv("leaseSeconds")
+	if !ok {
+		leaseSecondsRaw = "60" // Default value, just in case
+		log.Print("check env: leaseSeconds, using default: 60")
+	}
+	leaseSeconds, err := strconv.ParseInt(leaseSecondsRaw, 10, 32)
 	if err != nil {
-		return false, err
+		return 0, err
+	}
+	if leaseSeconds <= 0 {
+		return 0, fmt.Errorf("check env: leaseSeconds, must be positive, got: %v", leaseSeconds)
 	}
-	return proceed, nil
+	return time.Second * time.Duration(leaseSeconds), nil
 }
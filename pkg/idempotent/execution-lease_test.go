@@ -0,0 +1,110 @@
+package idempotent
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/functions/metadata"
+)
+
+func eventContext(eventID string) context.Context {
+	return metadata.NewContext(context.Background(), &metadata.Metadata{
+		EventID: eventID,
+	})
+}
+
+func TestExecuteWithLease(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := eventContext("event-1")
+
+	lease, err := ExecuteWithLease(ctx, store)
+	if err != nil || lease == nil {
+		t.Fatalf("first lease: lease = %v, err = %v", lease, err)
+	}
+
+	// Lease is still held, so a concurrent execution must not proceed
+	_, err = ExecuteWithLease(ctx, store)
+	if held, ok := err.(*LeaseHeldError); !ok || !held.RetryAfter.Equal(lease.Until) {
+		t.Errorf("second lease: expected LeaseHeldError, got %v", err)
+	}
+	if !Retryable(err) {
+		t.Error("held lease should be retryable")
+	}
+
+	if err := SetExecuteProgress(ctx, store, lease, map[string]interface{}{
+		"step": map[string]interface{}{"a": 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetExecuteProgress(ctx, store, lease, map[string]interface{}{
+		"step": map[string]interface{}{"b": 2},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	progress, err := GetExecuteProgress(ctx, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := progress["step"].(map[string]interface{})
+	if step["a"] != 1 || step["b"] != 2 {
+		t.Errorf("progress not merged: %v", step)
+	}
+
+	if err := ExecuteMarkComplete(ctx, store, lease); err != nil {
+		t.Fatal(err)
+	}
+	lease, err = ExecuteWithLease(ctx, store)
+	if err != ErrAlreadyCompleted || lease != nil {
+		t.Errorf("completed lease: lease = %v, err = %v", lease, err)
+	}
+	if Retryable(err) {
+		t.Error("completed execution should not be retryable")
+	}
+
+	// Other events are not affected
+	lease, err = ExecuteWithLease(eventContext("event-2"), store)
+	if err != nil || lease == nil {
+		t.Errorf("other event: lease = %v, err = %v", lease, err)
+	}
+}
+
+func TestEventKey(t *testing.T) {
+	defer os.Unsetenv("FUNCTION_NAME")
+
+	os.Setenv("FUNCTION_NAME", "on-user-update")
+	key, err := EventKey(eventContext("event-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "on-user-update:event-1" {
+		t.Errorf("EventKey = %q", key)
+	}
+
+	// Same event delivered to a different function must get its own lease
+	store := NewMemoryStore()
+	if lease, err := ExecuteWithLease(eventContext("event-1"), store); err != nil || lease == nil {
+		t.Fatalf("first function: lease = %v, err = %v", lease, err)
+	}
+	os.Setenv("FUNCTION_NAME", "on-file-uploaded")
+	if lease, err := ExecuteWithLease(eventContext("event-1"), store); err != nil || lease == nil {
+		t.Errorf("second function: lease = %v, err = %v", lease, err)
+	}
+}
+
+func TestLeaseDuration(t *testing.T) {
+	defer os.Unsetenv("leaseSeconds")
+	store := NewMemoryStore()
+	ctx := eventContext("event-1")
+
+	// Non-positive duration would make the heartbeat's ticker panic
+	for _, raw := range []string{"0", "-60"} {
+		os.Setenv("leaseSeconds", raw)
+		if d, err := LeaseDuration(); err == nil {
+			t.Errorf("LeaseDuration() = %v, want error for leaseSeconds=%v", d, raw)
+		}
+		if _, err := StartHeartbeat(ctx, store, &Lease{Key: "event-1"}); err == nil {
+			t.Errorf("StartHeartbeat() started for leaseSeconds=%v", raw)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package idempotent
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// FirestoreStore is a LeaseStore keeping leases as documents in a Firestore collection.
+type FirestoreStore struct {
+	client      *firestore.Client
+	collection  string
+	deadLetters string
+}
+
+// NewFirestoreStore returns a LeaseStore backed by the provided Firestore Client,
+// keeping its documents in the specified collection and dead letters in
+// the collection with `-dead-letters` suffix.
+func NewFirestoreStore(client *firestore.Client, collection string) *FirestoreStore {
+	return &FirestoreStore{
+		client:      client,
+		collection:  collection,
+		deadLetters: collection + "-dead-letters",
+	}
+}
+
+// Client returns the Firestore Client used by the store.
+func (s *FirestoreStore) Client() *firestore.Client {
+	return s.client
+}
+
+// Collection returns the collection with documents tracking executions.
+func (s *FirestoreStore) Collection() *firestore.CollectionRef {
+	return s.client.Collection(s.collection)
+}
+
+// DeadLetters returns the collection with dead-lettered executions.
+func (s *FirestoreStore) DeadLetters() *firestore.CollectionRef {
+	return s.client.Collection(s.deadLetters)
+}
+
+// Ref returns a document reference for the document tracking execution identified by key.
+func (s *FirestoreStore) Ref(key string) *firestore.DocumentRef {
+	return s.Collection().Doc(key)
+}
+
+// Acquire implements LeaseStore.
+func (s *FirestoreStore) Acquire(ctx context.Context, key string, until time.Time) (*Lease, error) {
+	var lease *Lease
+
+	ref := s.Ref(key)
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && grpc.Code(err) != codes.NotFound {
+			return err
+		}
+		token, attempts := int64(0), int64(0)
+		if doc.Exists() {
+			if token, attempts, err = checkRecord(key, doc.Data()); err != nil {
+				return err
+			}
+		}
+
+		newValue := map[string]interface{}{
+			"lease":     until,
+			"token":     token + 1,
+			"attempts":  attempts + 1,
+			"updatedAt": time.Now(),
+		}
+
+		_, err = doc.DataAt("createdAt")
+		if err != nil {
+			if grpc.Code(err) == codes.NotFound {
+				newValue["createdAt"] = time.Now()
+			} else {
+				return err
+			}
+		}
+
+		lease = &Lease{
+			Key:      key,
+			Token:    token + 1,
+			Until:    until,
+			Attempts: attempts + 1,
+		}
+		return tx.Set(ref, newValue, firestore.MergeAll)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// Renew implements LeaseStore.
+func (s *FirestoreStore) Renew(ctx context.Context, lease *Lease, until time.Time) error {
+	ref := s.Ref(lease.Key)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if grpc.Code(err) == codes.NotFound {
+				return ErrLeaseLost
+			}
+			return err
+		}
+		if err := CheckToken(doc.Data(), lease); err != nil {
+			return ErrLeaseLost
+		}
+		if done, _ := doc.Data()["done"].(bool); done {
+			return ErrLeaseLost
+		}
+		if val, ok := doc.Data()["lease"].(time.Time); !ok || time.Now().After(val) {
+			return ErrLeaseLost // someone else may already hold it
+		}
+
+		return tx.Set(ref, map[string]interface{}{
+			"lease":     until,
+			"updatedAt": time.Now(),
+		}, firestore.MergeAll)
+	})
+}
+
+// MarkComplete implements LeaseStore.
+func (s *FirestoreStore) MarkComplete(ctx context.Context, lease *Lease) error {
+	data, err := CompleteProgress()
+	if err != nil {
+		return err
+	}
+	return s.SetProgress(ctx, lease, data)
+}
+
+// Progress implements LeaseStore.
+func (s *FirestoreStore) Progress(ctx context.Context, key string) (map[string]interface{}, error) {
+	doc, err := s.Ref(key).Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Data(), nil
+}
+
+// SetProgress implements LeaseStore.
+func (s *FirestoreStore) SetProgress(ctx context.Context, lease *Lease, data map[string]interface{}) error {
+	ref := s.Ref(lease.Key)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := CheckToken(doc.Data(), lease); err != nil {
+			return err
+		}
+		return tx.Set(ref, data, firestore.MergeAll)
+	})
+}
+
+// DeadLetter implements LeaseStore.
+func (s *FirestoreStore) DeadLetter(ctx context.Context, lease *Lease, letter map[string]interface{}) error {
+	ref := s.Ref(lease.Key)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+		if err := CheckToken(doc.Data(), lease); err != nil {
+			return err
+		}
+		if err := tx.Set(s.DeadLetters().Doc(lease.Key), letter); err != nil {
+			return err
+		}
+		return tx.Set(ref, map[string]interface{}{
+			"deadLettered": true,
+			"updatedAt":    time.Now(),
+		}, firestore.MergeAll)
+	})
+}
+
+// Purge implements LeaseStore. Query of completed executions requires
+// a composite index on fields `done` and `updatedAt` of the collection.
+func (s *FirestoreStore) Purge(ctx context.Context, completedBefore, failedBefore time.Time) (int, error) {
+	queries := []firestore.Query{
+		s.Collection().Where("done", "==", true).Where("updatedAt", "<", completedBefore),
+		s.Collection().Where("updatedAt", "<", failedBefore),
+		s.DeadLetters().Where("deadLetteredAt", "<", failedBefore),
+	}
+
+	deleted := 0
+	for _, query := range queries {
+		n, err := s.deleteAll(ctx, query)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// deleteAll deletes all documents matching the query, in batches.
+func (s *FirestoreStore) deleteAll(ctx context.Context, query firestore.Query) (int, error) {
+	// Determine size of each step (since batch write MAX is: 500)
+	stepSize := 400
+
+	deleted := 0
+	for {
+		docs, err := query.Limit(stepSize).Documents(ctx).GetAll()
+		if err != nil {
+			return deleted, err
+		}
+		if len(docs) == 0 {
+			return deleted, nil // We are done here
+		}
+
+		batch := s.client.Batch()
+		for _, doc := range docs {
+			batch.Delete(doc.Ref)
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return deleted, err
+		}
+		deleted += len(docs)
+	}
+}
+
+// GetExecuteProgressRef returns a document reference for the document tracking progress of
+// indempotent completion of this function based on EventID specified in context metadata
+func GetExecuteProgressRef(ctx context.Context, store *FirestoreStore) (*firestore.DocumentRef, error) {
+	key, err := EventKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.Ref(key), nil
+}
@@ -0,0 +1,82 @@
+package idempotent
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrLeaseLost is returned when the lease of an execution can't be renewed,
+// because it already expired or the execution was completed in the meantime.
+var ErrLeaseLost = errors.New("lease lost")
+
+// Heartbeat keeps renewing the lease of an execution while the function is running.
+type Heartbeat struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+// StartHeartbeat starts renewing the lease in the background, every third of the lease duration.
+// Context of the returned Heartbeat is cancelled as soon as renewal fails, so the function
+// stops working on a lease it no longer holds.
+func StartHeartbeat(ctx context.Context, store LeaseStore, lease *Lease) (*Heartbeat, error) {
+	leaseDuration, err := LeaseDuration()
+	if err != nil {
+		return nil, err
+	}
+
+	hbCtx, cancel := context.WithCancel(ctx)
+	h := &Heartbeat{
+		ctx:    hbCtx,
+		cancel: cancel,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go h.run(store, lease, leaseDuration)
+	return h, nil
+}
+
+func (h *Heartbeat) run(store LeaseStore, lease *Lease, leaseDuration time.Duration) {
+	defer close(h.done)
+
+	ticker := time.NewTicker(leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := store.Renew(h.ctx, lease, time.Now().Add(leaseDuration)); err != nil {
+				log.Printf("heartbeat: renewing lease %v: %v", lease.Key, err)
+				h.err = err
+				h.cancel() // abort the execution, since the lease is no longer ours
+				return
+			}
+		}
+	}
+}
+
+// Context returns a context that is cancelled when the lease can't be renewed.
+func (h *Heartbeat) Context() context.Context {
+	return h.ctx
+}
+
+// Stop stops renewing the lease and returns the error renewal failed with, if any.
+// It is safe to call Stop multiple times.
+func (h *Heartbeat) Stop() error {
+	h.once.Do(func() {
+		close(h.stop)
+		<-h.done
+		h.cancel()
+	})
+	return h.err
+}
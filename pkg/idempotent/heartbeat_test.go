@@ -0,0 +1,44 @@
+package idempotent
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	defer os.Unsetenv("leaseSeconds")
+	os.Setenv("leaseSeconds", "1")
+
+	store := NewMemoryStore()
+	ctx := eventContext("event-1")
+	lease, err := ExecuteWithLease(ctx, store)
+	if err != nil || lease == nil {
+		t.Fatalf("lease = %v, err = %v", lease, err)
+	}
+
+	hb, err := StartHeartbeat(ctx, store, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hb.Stop()
+
+	// Lease would have expired by now, if it wasn't renewed
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := ExecuteWithLease(ctx, store); err == nil {
+		t.Error("expected lease to still be held")
+	}
+
+	// Renewal fails once the execution is completed
+	if err := ExecuteMarkComplete(ctx, store, lease); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-hb.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat context wasn't cancelled")
+	}
+	if err := hb.Stop(); err != ErrLeaseLost {
+		t.Errorf("Stop() = %v, want ErrLeaseLost", err)
+	}
+}
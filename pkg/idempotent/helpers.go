@@ -2,33 +2,52 @@ package idempotent
 
 import (
 	"context"
-	"time"
+	"os"
 
-	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/functions/metadata"
 )
 
-// ExecuteMarkComplete marks indempotent function as complete based
-// on EventID specified in context metadata
-func ExecuteMarkComplete(ctx context.Context) error {
-	ref, err := GetExecuteProgressRef(ctx)
+// ExecuteMarkComplete marks indempotent function as complete,
+// unless the lease was meanwhile granted to another execution
+func ExecuteMarkComplete(ctx context.Context, store LeaseStore, lease *Lease) error {
+	return store.MarkComplete(ctx, lease)
+}
+
+// GetExecuteProgress returns data tracking progress of indempotent completion
+// of this function based on EventID specified in context metadata
+func GetExecuteProgress(ctx context.Context, store LeaseStore) (map[string]interface{}, error) {
+	key, err := EventKey(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = ref.Set(ctx, map[string]interface{}{
-		"done":      true,
-		"updatedAt": time.Now(),
-	}, firestore.MergeAll)
+	return store.Progress(ctx, key)
+}
 
-	return err
+// SetExecuteProgress merges data into progress of indempotent completion
+// of this function, unless the lease was meanwhile granted to another execution
+func SetExecuteProgress(ctx context.Context, store LeaseStore, lease *Lease, data map[string]interface{}) error {
+	return store.SetProgress(ctx, lease, data)
 }
 
-// GetExecuteProgressRef returns a document reference for the document tracking progress of
-// indempotent completion of this function based on EventID specified in context metadata
-func GetExecuteProgressRef(ctx context.Context) (*firestore.DocumentRef, error) {
+// EventKey returns the key identifying execution of this function
+// based on EventID specified in context metadata. Keys are namespaced
+// by FunctionName, so functions triggered by the same event don't collide.
+func EventKey(ctx context.Context) (string, error) {
 	meta, err := metadata.FromContext(ctx)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	if name := FunctionName(); name != "" {
+		return name + ":" + meta.EventID, nil
+	}
+	return meta.EventID, nil
+}
+
+// FunctionName returns the name of the running function, as provided by
+// the Cloud Functions runtime (`FUNCTION_NAME` or `K_SERVICE` on newer runtimes).
+func FunctionName() string {
+	if name, ok := os.LookupEnv("FUNCTION_NAME"); ok {
+		return name
 	}
-	return Client.Collection("user-events").Doc(meta.EventID), nil
+	return os.Getenv("K_SERVICE")
 }
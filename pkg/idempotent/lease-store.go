@@ -0,0 +1,105 @@
+package idempotent
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrStaleToken is returned when writing with a lease whose fencing token was
+// superseded, because the lease expired and another execution acquired it.
+var ErrStaleToken = errors.New("stale fencing token")
+
+// Lease is a lease granted on an execution of the function.
+type Lease struct {
+	// Key identifies the execution the lease was granted on.
+	Key string
+	// Token is a fencing token, increased with every lease granted on the execution.
+	Token int64
+	// Until is the time lease expires at, unless renewed.
+	Until time.Time
+	// Attempts counts attempts of the execution, including this one. Unlike Token, it doesn't count
+	// attempts that stopped with ErrDeadlineNear, as those were making progress.
+	Attempts int64
+}
+
+// LeaseStore persists execution leases and progress of indempotent functions.
+type LeaseStore interface {
+	// Acquire grants a lease on the execution identified by key until the specified time.
+	// It returns ErrAlreadyCompleted or ErrDeadLettered if the execution shouldn't proceed,
+	// and LeaseHeldError when the lease is currently held by some other execution.
+	Acquire(ctx context.Context, key string, until time.Time) (*Lease, error)
+	// Renew extends a lease that is still held until the specified time. It returns ErrLeaseLost
+	// if the lease already expired, was granted to someone else or the execution completed.
+	Renew(ctx context.Context, lease *Lease, until time.Time) error
+	// MarkComplete marks the execution as complete, unless lease has a stale token.
+	MarkComplete(ctx context.Context, lease *Lease) error
+	// Progress returns all the data tracked for the execution identified by key.
+	Progress(ctx context.Context, key string) (map[string]interface{}, error)
+	// SetProgress merges data into the data tracked for the execution, unless lease has a stale token.
+	SetProgress(ctx context.Context, lease *Lease, data map[string]interface{}) error
+	// DeadLetter moves the execution into dead letters, unless lease has a stale token. Further
+	// leases on a dead-lettered execution aren't granted, as if it was already completed.
+	DeadLetter(ctx context.Context, lease *Lease, letter map[string]interface{}) error
+	// Purge deletes records of executions completed before completedBefore, and records of all
+	// other (failed or abandoned) executions and dead letters last updated before failedBefore.
+	// It returns the number of deleted records.
+	Purge(ctx context.Context, completedBefore, failedBefore time.Time) (int, error)
+}
+
+// checkRecord verifies a lease can be granted on the execution tracked by record,
+// returning the fencing token of the last granted lease and the number of attempts so far.
+func checkRecord(key string, record map[string]interface{}) (token int64, attempts int64, err error) {
+	for _, field := range []string{"done", "deadLettered"} {
+		raw, ok := record[field]
+		if !ok {
+			continue
+		}
+		val, ok := raw.(bool)
+		if !ok {
+			return 0, 0, &CorruptRecordError{Key: key, Field: field, Value: raw}
+		}
+		if val && field == "done" {
+			return 0, 0, ErrAlreadyCompleted // Since this Event was already processed, just exit
+		}
+		if val {
+			return 0, 0, ErrDeadLettered // Event was given up on, it can only be replayed
+		}
+	}
+
+	if raw, ok := record["lease"]; ok {
+		until, ok := raw.(time.Time)
+		if !ok {
+			return 0, 0, &CorruptRecordError{Key: key, Field: "lease", Value: raw}
+		}
+		if time.Now().Before(until) {
+			return 0, 0, &LeaseHeldError{Key: key, RetryAfter: until}
+		}
+	}
+
+	for _, field := range []string{"token", "attempts"} {
+		raw, ok := record[field]
+		if !ok {
+			continue
+		}
+		val, ok := raw.(int64)
+		if !ok {
+			return 0, 0, &CorruptRecordError{Key: key, Field: field, Value: raw}
+		}
+		if field == "token" {
+			token = val
+		} else {
+			attempts = val
+		}
+	}
+	return token, attempts, nil
+}
+
+// CheckToken verifies that lease holds the newest fencing token, based on the tracked data of the execution.
+func CheckToken(data map[string]interface{}, lease *Lease) error {
+	token, _ := data["token"].(int64)
+	if token != lease.Token {
+		return ErrStaleToken
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package idempotent
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFencingToken(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	// First lease expires right away, so the next execution takes over
+	stale, err := store.Acquire(ctx, "event-1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := store.Acquire(ctx, "event-1", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Token <= stale.Token {
+		t.Fatalf("token not increased: %v <= %v", current.Token, stale.Token)
+	}
+
+	if err := store.SetProgress(ctx, stale, map[string]interface{}{"a": 1}); err != ErrStaleToken {
+		t.Errorf("SetProgress with stale token = %v, want ErrStaleToken", err)
+	}
+	if err := store.MarkComplete(ctx, stale); err != ErrStaleToken {
+		t.Errorf("MarkComplete with stale token = %v, want ErrStaleToken", err)
+	}
+	if err := store.Renew(ctx, stale, time.Now().Add(time.Minute)); err != ErrLeaseLost {
+		t.Errorf("Renew with stale token = %v, want ErrLeaseLost", err)
+	}
+	if err := store.MarkComplete(ctx, current); err != nil {
+		t.Errorf("MarkComplete with current token = %v", err)
+	}
+}
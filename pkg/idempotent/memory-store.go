@@ -0,0 +1,195 @@
+package idempotent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a LeaseStore keeping leases in memory, meant for testing functions
+// without access to Firestore (or its emulator).
+type MemoryStore struct {
+	mu          sync.Mutex
+	records     map[string]map[string]interface{}
+	deadLetters map[string]map[string]interface{}
+}
+
+// NewMemoryStore returns an empty in-memory LeaseStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records:     map[string]map[string]interface{}{},
+		deadLetters: map[string]map[string]interface{}{},
+	}
+}
+
+// Acquire implements LeaseStore.
+func (s *MemoryStore) Acquire(ctx context.Context, key string, until time.Time) (*Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, attempts := int64(0), int64(0)
+	record, ok := s.records[key]
+	if ok {
+		var err error
+		if token, attempts, err = checkRecord(key, record); err != nil {
+			return nil, err
+		}
+	} else {
+		record = map[string]interface{}{
+			"createdAt": time.Now(),
+		}
+		s.records[key] = record
+	}
+
+	record["lease"] = until
+	record["token"] = token + 1
+	record["attempts"] = attempts + 1
+	record["updatedAt"] = time.Now()
+	return &Lease{
+		Key:      key,
+		Token:    token + 1,
+		Until:    until,
+		Attempts: attempts + 1,
+	}, nil
+}
+
+// Renew implements LeaseStore.
+func (s *MemoryStore) Renew(ctx context.Context, lease *Lease, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[lease.Key]
+	if !ok {
+		return ErrLeaseLost
+	}
+	if err := CheckToken(record, lease); err != nil {
+		return ErrLeaseLost
+	}
+	if done, _ := record["done"].(bool); done {
+		return ErrLeaseLost
+	}
+	if val, ok := record["lease"].(time.Time); !ok || time.Now().After(val) {
+		return ErrLeaseLost // someone else may already hold it
+	}
+
+	record["lease"] = until
+	record["updatedAt"] = time.Now()
+	return nil
+}
+
+// MarkComplete implements LeaseStore.
+func (s *MemoryStore) MarkComplete(ctx context.Context, lease *Lease) error {
+	data, err := CompleteProgress()
+	if err != nil {
+		return err
+	}
+	return s.SetProgress(ctx, lease, data)
+}
+
+// Progress implements LeaseStore.
+func (s *MemoryStore) Progress(ctx context.Context, key string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok {
+		return nil, errors.New("record doesn't exist")
+	}
+	return copyMap(record), nil
+}
+
+// SetProgress implements LeaseStore.
+func (s *MemoryStore) SetProgress(ctx context.Context, lease *Lease, data map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[lease.Key]
+	if !ok {
+		return errors.New("record doesn't exist")
+	}
+	if err := CheckToken(record, lease); err != nil {
+		return err
+	}
+	mergeMap(record, data)
+	return nil
+}
+
+// DeadLetter implements LeaseStore.
+func (s *MemoryStore) DeadLetter(ctx context.Context, lease *Lease, letter map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[lease.Key]
+	if !ok {
+		return errors.New("record doesn't exist")
+	}
+	if err := CheckToken(record, lease); err != nil {
+		return err
+	}
+	s.deadLetters[lease.Key] = copyMap(letter)
+	record["deadLettered"] = true
+	record["updatedAt"] = time.Now()
+	return nil
+}
+
+// Purge implements LeaseStore.
+func (s *MemoryStore) Purge(ctx context.Context, completedBefore, failedBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for key, record := range s.records {
+		updatedAt, _ := record["updatedAt"].(time.Time)
+		done, _ := record["done"].(bool)
+		if (done && updatedAt.Before(completedBefore)) || updatedAt.Before(failedBefore) {
+			delete(s.records, key)
+			deleted++
+		}
+	}
+	for key, letter := range s.deadLetters {
+		if deadLetteredAt, _ := letter["deadLetteredAt"].(time.Time); deadLetteredAt.Before(failedBefore) {
+			delete(s.deadLetters, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// DeadLetters returns all the dead-lettered executions, by their key.
+func (s *MemoryStore) DeadLetters() map[string]map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters := make(map[string]map[string]interface{}, len(s.deadLetters))
+	for k, v := range s.deadLetters {
+		letters[k] = copyMap(v)
+	}
+	return letters
+}
+
+// mergeMap merges src into dst the same way firestore.MergeAll merges nested maps.
+func mergeMap(dst, src map[string]interface{}) {
+	for k, v := range src {
+		if srcMap, ok := v.(map[string]interface{}); ok {
+			if dstMap, ok := dst[k].(map[string]interface{}); ok {
+				mergeMap(dstMap, srcMap)
+				continue
+			}
+			v = copyMap(srcMap)
+		}
+		dst[k] = v
+	}
+}
+
+// copyMap returns a deep copy of the nested maps in src.
+func copyMap(src map[string]interface{}) map[string]interface{} {
+	dst := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = copyMap(m)
+		}
+		dst[k] = v
+	}
+	return dst
+}
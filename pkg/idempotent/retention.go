@@ -0,0 +1,49 @@
+package idempotent
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// CompletedRetention returns for how long records of completed executions are kept,
+// configured in days with env variable `retentionDays`, which has to be positive.
+func CompletedRetention() (time.Duration, error) {
+	return retentionDays("retentionDays", 7)
+}
+
+// FailedRetention returns for how long records of failed (or abandoned) and dead-lettered
+// executions are kept, configured in days with env variable `failedRetentionDays`, which has to be positive.
+func FailedRetention() (time.Duration, error) {
+	return retentionDays("failedRetentionDays", 30)
+}
+
+func retentionDays(env string, defaultDays int64) (time.Duration, error) {
+	days := defaultDays
+	if daysRaw, ok := os.LookupEnv(env); ok {
+		var err error
+		if days, err = strconv.ParseInt(daysRaw, 10, 32); err != nil {
+			return 0, err
+		}
+	}
+	if days <= 0 {
+		// Purge would delete every record, including the ones still in progress
+		return 0, fmt.Errorf("check env: %v, must be positive, got: %v", env, days)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// CompleteProgress returns data marking an execution as complete, including `expireAt`
+// field that Firestore TTL policy deletes records by, once retention passes.
+func CompleteProgress() (map[string]interface{}, error) {
+	retention, err := CompletedRetention()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"done":      true,
+		"updatedAt": time.Now(),
+		"expireAt":  time.Now().Add(retention),
+	}, nil
+}
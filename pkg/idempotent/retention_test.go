@@ -0,0 +1,57 @@
+package idempotent
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPurge(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	completed, _ := store.Acquire(ctx, "completed", time.Now().Add(time.Minute))
+	if err := store.MarkComplete(ctx, completed); err != nil {
+		t.Fatal(err)
+	}
+	if progress, _ := store.Progress(ctx, "completed"); progress["expireAt"] == nil {
+		t.Error("completed record has no `expireAt` for TTL policy")
+	}
+	if _, err := store.Acquire(ctx, "running", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Completed records are purged sooner than the others
+	n, err := store.Purge(ctx, time.Now().Add(time.Second), time.Now().Add(-time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Purge = %v, %v; want 1 deleted", n, err)
+	}
+	if _, err := store.Progress(ctx, "completed"); err == nil {
+		t.Error("completed record wasn't purged")
+	}
+	if _, err := store.Progress(ctx, "running"); err != nil {
+		t.Error("running record was purged")
+	}
+}
+
+func TestRetention(t *testing.T) {
+	defer os.Unsetenv("retentionDays")
+	defer os.Unsetenv("failedRetentionDays")
+
+	if retention, err := CompletedRetention(); err != nil || retention != 7*24*time.Hour {
+		t.Errorf("CompletedRetention() = %v, %v; want default of 7 days", retention, err)
+	}
+
+	// Non-positive retention would purge records still in progress
+	for _, raw := range []string{"0", "-1"} {
+		os.Setenv("retentionDays", raw)
+		os.Setenv("failedRetentionDays", raw)
+		if retention, err := CompletedRetention(); err == nil {
+			t.Errorf("CompletedRetention() = %v, want error for retentionDays=%v", retention, raw)
+		}
+		if retention, err := FailedRetention(); err == nil {
+			t.Errorf("FailedRetention() = %v, want error for failedRetentionDays=%v", retention, raw)
+		}
+	}
+}
@@ -2,21 +2,39 @@ package transaction
 
 import (
 	"context"
-	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/makuc/a-novels-backend/pkg/idempotent"
 )
 
-// ExecuteMarkCompleteTransaction marks indempotent function as complete based
-// on EventID specified in context metadata
-func ExecuteMarkCompleteTransaction(ctx context.Context, tx *firestore.Transaction) error {
-	ref, err := idempotent.GetExecuteProgressRef(ctx)
+// ExecuteMarkCompleteTransaction marks indempotent function as complete, unless
+// the lease was meanwhile granted to another execution
+func ExecuteMarkCompleteTransaction(ctx context.Context, store *idempotent.FirestoreStore, lease *idempotent.Lease, tx *firestore.Transaction) error {
+	data, err := idempotent.CompleteProgress()
 	if err != nil {
 		return err
 	}
-	return tx.Set(ref, map[string]interface{}{
-		"done":      true,
-		"updatedAt": time.Now(),
-	}, firestore.MergeAll)
+	return SetExecuteProgressTransaction(ctx, store, lease, tx, data)
+}
+
+// SetExecuteProgressTransaction merges data into progress of indempotent completion of this function,
+// unless the lease was meanwhile granted to another execution. It reads the document tracking progress,
+// so it has to be called before any writes are made in the transaction.
+func SetExecuteProgressTransaction(ctx context.Context, store *idempotent.FirestoreStore, lease *idempotent.Lease, tx *firestore.Transaction, data map[string]interface{}) error {
+	ref := store.Ref(lease.Key)
+	doc, err := tx.Get(ref)
+	if err != nil {
+		return err
+	}
+	if err := idempotent.CheckToken(doc.Data(), lease); err != nil {
+		return err
+	}
+	return tx.Set(ref, data, firestore.MergeAll)
+}
+
+// SaveCheckpointTransaction saves checkpoint into progress of this execution, unless
+// the lease was meanwhile granted to another execution. It has to be called before
+// any writes are made in the transaction.
+func SaveCheckpointTransaction(ctx context.Context, store *idempotent.FirestoreStore, lease *idempotent.Lease, tx *firestore.Transaction, cp *idempotent.Checkpoint) error {
+	return SetExecuteProgressTransaction(ctx, store, lease, tx, cp.Progress())
 }
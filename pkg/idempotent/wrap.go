@@ -0,0 +1,65 @@
+package idempotent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// Handler processes an event under a granted lease. Its ctx is cancelled as soon as the lease is lost,
+// and all writes tracking progress have to be made with lease.
+type Handler func(ctx context.Context, lease *Lease) error
+
+// Wrap executes h indempotently for the event e (Firestore, GCS, Auth, ...) based on the EventID specified
+// in context metadata. It acquires the lease, captures the payload, keeps the lease alive while h is running
+// and marks the execution complete once h succeeds. Errors are logged and classified: nil is returned when the
+// event shouldn't be retried (already completed, corrupt or dead-lettered), otherwise the error is returned
+// for the platform to retry the function.
+func Wrap(ctx context.Context, store LeaseStore, e interface{}, h Handler) error {
+	lease, err := ExecuteWithLease(ctx, store)
+	if err != nil {
+		if !Retryable(err) {
+			log.Printf("idempotent: dropping event: %v", err)
+			return nil // this EventID was already completed, or can't ever be
+		}
+		log.Printf("idempotent: acquiring lease: %v", err)
+		return err
+	}
+	if err := ExecuteCapture(ctx, store, lease, e); err != nil {
+		log.Printf("idempotent: capturing %v: %v", lease.Key, err) // only needed for replays, carry on
+	}
+
+	hb, err := StartHeartbeat(ctx, store, lease)
+	if err != nil {
+		log.Printf("idempotent: starting heartbeat of %v: %v", lease.Key, err)
+		return err
+	}
+	defer hb.Stop()
+
+	if err := runHandler(hb.Context(), lease, h); err != nil {
+		log.Printf("idempotent: executing %v: %v", lease.Key, err)
+		hb.Stop()
+		return ExecuteFailed(ctx, store, lease, e, err)
+	}
+
+	if err := hb.Stop(); err != nil {
+		log.Printf("idempotent: heartbeat of %v: %v", lease.Key, err)
+		return err // lease was lost, so we can't mark it complete
+	}
+	if err := ExecuteMarkComplete(ctx, store, lease); err != nil {
+		log.Printf("idempotent: completing %v: %v", lease.Key, err)
+		return err
+	}
+	return nil
+}
+
+// runHandler executes h, turning a panic into an error so the failure gets recorded.
+func runHandler(ctx context.Context, lease *Lease, h Handler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return h(ctx, lease)
+}
@@ -0,0 +1,42 @@
+package idempotent
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := eventContext("event-1")
+
+	calls := 0
+	handler := func(ctx context.Context, lease *Lease) error {
+		calls++
+		return SetExecuteProgress(ctx, store, lease, map[string]interface{}{"handled": true})
+	}
+	for i := 0; i < 2; i++ {
+		if err := Wrap(ctx, store, nil, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler called %v times, want once", calls)
+	}
+	if progress, _ := GetExecuteProgress(ctx, store); progress["done"] != true {
+		t.Errorf("execution not marked complete: %v", progress)
+	}
+
+	// Failures and panics are recorded and returned for the platform to retry
+	ctx = eventContext("event-2")
+	cause := errors.New("busy")
+	if err := Wrap(ctx, store, nil, func(context.Context, *Lease) error { return cause }); err != cause {
+		t.Errorf("Wrap = %v, want %v", err, cause)
+	}
+	if err := Wrap(ctx, store, nil, func(context.Context, *Lease) error { panic("oops") }); err == nil {
+		t.Error("expected error from panicking handler")
+	}
+	if progress, _ := GetExecuteProgress(ctx, store); progress["done"] == true || progress["lastError"] == nil {
+		t.Errorf("failure not recorded: %v", progress)
+	}
+}